@@ -0,0 +1,148 @@
+package metric
+
+import (
+	"cmp"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// AbsenceEvent is raised when a measure or an input has not been reported
+// for the number of sampling intervals set by WithAbsence, and again when it reports back.
+type AbsenceEvent struct {
+	Key      string    `json:"key,omitempty"`   // series key of the measure, empty for an input
+	Input    string    `json:"input,omitempty"` // name of the input that reported the measure
+	LastSeen time.Time `json:"last_seen"`       // zero if an input has never reported
+	Time     time.Time `json:"ts"`
+	Absent   bool      `json:"absent"` // false when it reports back
+}
+
+// AbsenceHandler is called from the collector loop while the collector is locked,
+// it should not call the methods of the collector.
+type AbsenceHandler func(AbsenceEvent)
+
+// LogAbsence is an AbsenceHandler that logs the events with slog.
+func LogAbsence(ev AbsenceEvent) {
+	if ev.Absent {
+		slog.Warn("Metric absent", "key", ev.Key, "input", ev.Input, "last_seen", ev.LastSeen)
+	} else {
+		slog.Info("Metric reported back", "key", ev.Key, "input", ev.Input)
+	}
+}
+
+// WithAbsence enables the absence detection. A measure is absent if it has not been reported
+// for n intervals of its input, which is the interval of InputInterval or the sampling interval.
+// An input is absent if it has not gathered successfully for n of its intervals.
+// The handler can be nil if only Staleness() and WithAbsenceMetric are used.
+func WithAbsence(n int, handler AbsenceHandler) CollectorOption {
+	return func(c *Collector) {
+		c.absenceIntervals = n
+		c.absenceHandler = handler
+	}
+}
+
+// WithAbsenceMetric records the number of absent measures and inputs as a gauge
+// of the name on every sampling tick, while the absence detection is enabled.
+func WithAbsenceMetric(name string) CollectorOption {
+	return func(c *Collector) {
+		c.absenceMetric = name
+	}
+}
+
+// Staleness is the time since a measure was reported last.
+type Staleness struct {
+	Key      string        `json:"key"`
+	Input    string        `json:"input,omitempty"`
+	LastSeen time.Time     `json:"last_seen"`
+	Age      time.Duration `json:"age"`
+	Absent   bool          `json:"absent"`
+}
+
+// Staleness returns the staleness of all time series sorted by the age, the stalest first.
+func (c *Collector) Staleness() []Staleness {
+	c.Lock()
+	defer c.Unlock()
+	now := c.clock.Now()
+	ret := make([]Staleness, 0, len(c.lastSeen))
+	for key, seen := range c.lastSeen {
+		ret = append(ret, Staleness{
+			Key:      key,
+			Input:    c.lastInputs[key],
+			LastSeen: seen,
+			Age:      now.Sub(seen),
+			Absent:   c.absent[key],
+		})
+	}
+	slices.SortFunc(ret, func(a, b Staleness) int {
+		if ret := cmp.Compare(b.Age, a.Age); ret != 0 {
+			return ret
+		}
+		return cmp.Compare(a.Key, b.Key)
+	})
+	return ret
+}
+
+// seen marks the measure as reported, the caller should hold the lock.
+func (c *Collector) seen(key string, input string, tm time.Time) {
+	c.lastSeen[key] = tm
+	if input != "" {
+		c.lastInputs[key] = input
+	}
+	if c.absent[key] {
+		delete(c.absent, key)
+		c.raiseAbsence(AbsenceEvent{Key: key, Input: c.lastInputs[key], LastSeen: tm, Time: tm})
+	}
+}
+
+// detectAbsence raises the events of the measures and inputs that become absent,
+// and records the absence metric. The caller should hold the lock.
+func (c *Collector) detectAbsence(now time.Time) {
+	if c.absenceIntervals <= 0 {
+		return
+	}
+	intervals := make(map[string]time.Duration, len(c.inputs))
+	var absentInputs int
+	for _, in := range c.inputs {
+		interval := c.samplingInterval
+		if in.interval > 0 {
+			interval = in.interval
+		}
+		intervals[in.name] = interval
+		seen := in.lastSeenTime()
+		since := seen
+		if since.IsZero() {
+			since = in.added
+		}
+		if now.Sub(since) > time.Duration(c.absenceIntervals)*interval {
+			absentInputs++
+			if !in.absent.Swap(true) {
+				c.raiseAbsence(AbsenceEvent{Input: in.name, LastSeen: seen, Time: now, Absent: true})
+			}
+		} else if in.absent.Swap(false) {
+			c.raiseAbsence(AbsenceEvent{Input: in.name, LastSeen: seen, Time: now})
+		}
+	}
+	for key, seen := range c.lastSeen {
+		if c.absent[key] || key == c.absenceMetric {
+			continue
+		}
+		input := c.lastInputs[key]
+		interval, ok := intervals[input]
+		if !ok {
+			interval = c.samplingInterval
+		}
+		if now.Sub(seen) > time.Duration(c.absenceIntervals)*interval {
+			c.absent[key] = true
+			c.raiseAbsence(AbsenceEvent{Key: key, Input: input, LastSeen: seen, Time: now, Absent: true})
+		}
+	}
+	if c.absenceMetric != "" {
+		c.addMeasure(Measure{Name: c.absenceMetric, Value: float64(len(c.absent) + absentInputs), Type: GaugeType(UnitShort)}, "", now)
+	}
+}
+
+func (c *Collector) raiseAbsence(ev AbsenceEvent) {
+	if c.absenceHandler != nil {
+		c.absenceHandler(ev)
+	}
+}
@@ -0,0 +1,646 @@
+package metric
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FieldValue returns the value of the field of a Value,
+// the field names are the same as the ones of the dashboard:
+//
+//	counter:   value
+//	gauge:     avg, last
+//	meter:     avg, first, last, min, max
+//	timer:     avg, min, max in nanoseconds
+//	odometer:  first, last, diff, non_negative_diff, abs_diff, increase
+//	rate:      value in per second, see Rate
+//	band:      mean, stddev, upper, lower, zscore, see Band
+//	forecast:  fitted, slope, next, horizon, time_to_threshold in nanoseconds, see Forecast
+//	anomaly:   value, baseline, score, abs_score, anomaly as 1 or 0, see Anomaly
+//	unique:    value of the estimated number of the distinct keys
+//	histogram: p50, p90, p99, p999 ... of the percentiles of the type
+//	bucket_histogram: sum, avg, le_0.5 ... le_inf of the cumulative counts,
+//	                  and p50, p99 ... estimated by BucketHistogramValue.Quantile
+//
+// "samples" is supported by all types. A derived value is referred to by the ID
+// of the deriver followed by the field, e.g. "ma5.avg".
+// The derivers of a field, e.g. ForecastField, default to the primary field, which is
+// the value of counters and uniques, the avg of gauges, meters and timers and the last of odometers.
+// It returns false if the field is unknown or the value has no samples.
+func FieldValue(v Value, field string) (float64, bool) {
+	if id, sub, ok := strings.Cut(field, "."); ok {
+		if dv, ok := derivedValues(v)[id]; ok {
+			return FieldValue(dv, sub)
+		}
+	}
+	switch val := v.(type) {
+	case *CounterValue:
+		if val.Samples == 0 {
+			return 0, false
+		}
+		switch field {
+		case "value":
+			return val.Value, true
+		case "samples":
+			return float64(val.Samples), true
+		}
+	case *GaugeValue:
+		if val.Samples == 0 {
+			return 0, false
+		}
+		switch field {
+		case "avg":
+			return val.Sum / float64(val.Samples), true
+		case "last":
+			return val.Value, true
+		case "samples":
+			return float64(val.Samples), true
+		}
+	case *MeterValue:
+		if val.Samples == 0 {
+			return 0, false
+		}
+		switch field {
+		case "avg":
+			return val.Sum / float64(val.Samples), true
+		case "first":
+			return val.First, true
+		case "last":
+			return val.Last, true
+		case "min":
+			return val.Min, true
+		case "max":
+			return val.Max, true
+		case "samples":
+			return float64(val.Samples), true
+		}
+	case *TimerValue:
+		if val.Samples == 0 {
+			return 0, false
+		}
+		switch field {
+		case "avg":
+			return float64(val.Sum / time.Duration(val.Samples)), true
+		case "min":
+			return float64(val.Min), true
+		case "max":
+			return float64(val.Max), true
+		case "samples":
+			return float64(val.Samples), true
+		}
+	case *OdometerValue:
+		if val.Samples == 0 {
+			return 0, false
+		}
+		switch field {
+		case "first":
+			return val.First, true
+		case "last":
+			return val.Last, true
+		case "diff":
+			return val.Diff(), true
+		case "non_negative_diff":
+			return val.NonNegativeDiff(), true
+		case "abs_diff":
+			return val.AbsDiff(), true
+		case "increase":
+			return val.Increase(), true
+		case "samples":
+			return float64(val.Samples), true
+		}
+	case *UniqueValue:
+		if val.Samples == 0 {
+			return 0, false
+		}
+		switch field {
+		case "value":
+			return val.Value, true
+		case "samples":
+			return float64(val.Samples), true
+		}
+	case *HistogramValue:
+		if val.Samples == 0 {
+			return 0, false
+		}
+		if field == "samples" {
+			return float64(val.Samples), true
+		}
+		for i, p := range val.P {
+			if percentileName(p) == field && i < len(val.Values) {
+				return val.Values[i], true
+			}
+		}
+	case *RateValue:
+		if val.Samples == 0 {
+			return 0, false
+		}
+		switch field {
+		case "value":
+			return val.Value, true
+		case "samples":
+			return float64(val.Samples), true
+		}
+	case *BandValue:
+		if val.Bins == 0 {
+			return 0, false
+		}
+		switch field {
+		case "mean":
+			return val.Mean, true
+		case "stddev":
+			return val.StdDev, true
+		case "upper":
+			return val.Upper, true
+		case "lower":
+			return val.Lower, true
+		case "zscore":
+			return val.ZScore, true
+		case "bins":
+			return float64(val.Bins), true
+		}
+	case *ForecastValue:
+		if val.Bins == 0 {
+			return 0, false
+		}
+		switch field {
+		case "fitted":
+			return val.Fitted, true
+		case "slope":
+			return val.Slope, true
+		case "next":
+			if len(val.Values) > 0 {
+				return val.Values[0], true
+			}
+		case "horizon":
+			if len(val.Values) > 0 {
+				return val.Values[len(val.Values)-1], true
+			}
+		case "time_to_threshold":
+			if val.TimeToThreshold >= 0 {
+				return float64(val.TimeToThreshold), true
+			}
+		case "bins":
+			return float64(val.Bins), true
+		}
+	case *AnomalyValue:
+		if val.Bins == 0 {
+			return 0, false
+		}
+		switch field {
+		case "value":
+			return val.Value, true
+		case "baseline":
+			return val.Baseline, true
+		case "score":
+			return val.Score, true
+		case "abs_score":
+			return math.Abs(val.Score), true
+		case "anomaly":
+			if val.Anomaly {
+				return 1, true
+			}
+			return 0, true
+		case "bins":
+			return float64(val.Bins), true
+		}
+	case *BucketHistogramValue:
+		if val.Samples == 0 {
+			return 0, false
+		}
+		switch field {
+		case "samples":
+			return float64(val.Samples), true
+		case "sum":
+			return val.Sum, true
+		case "avg":
+			return val.Sum / float64(val.Samples), true
+		}
+		for i, name := range val.BucketNames() {
+			if name == field && i < len(val.Counts) {
+				return float64(val.Counts[i]), true
+			}
+		}
+		if q, ok := parsePercentileName(field); ok {
+			return val.Quantile(q), true
+		}
+	}
+	return 0, false
+}
+
+// percentileName returns the field name of the percentile, e.g. p50 for 0.5 and p999 for 0.999.
+func percentileName(p float64) string {
+	name := fmt.Sprintf("p%d", int(p*1000))
+	if name[len(name)-1] == '0' {
+		name = name[:len(name)-1]
+	}
+	return name
+}
+
+// parsePercentileName is the reverse of percentileName, e.g. 0.99 for p99 and 0.999 for p999.
+func parsePercentileName(name string) (float64, bool) {
+	digits, ok := strings.CutPrefix(name, "p")
+	if !ok || len(digits) == 0 || len(digits) > 3 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(digits)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	if len(digits) == 3 {
+		return float64(n) / 1000, true
+	}
+	return float64(n) / 100, true
+}
+
+func derivedValues(v Value) map[string]Value {
+	switch val := v.(type) {
+	case *CounterValue:
+		return val.DerivedValues
+	case *GaugeValue:
+		return val.DerivedValues
+	case *MeterValue:
+		return val.DerivedValues
+	case *TimerValue:
+		return val.DerivedValues
+	case *HistogramValue:
+		return val.DerivedValues
+	case *OdometerValue:
+		return val.DerivedValues
+	case *BucketHistogramValue:
+		return val.DerivedValues
+	case *UniqueValue:
+		return val.DerivedValues
+	}
+	return nil
+}
+
+// AlertState is the state of an alert of a rule on a time series.
+type AlertState string
+
+const (
+	// AlertPending is the state while the condition is met for fewer bins than required.
+	AlertPending AlertState = "pending"
+	// AlertFiring is the state while the condition is met for the required number of bins.
+	AlertFiring AlertState = "firing"
+	// AlertResolved is the state when the condition of a firing alert is no longer met.
+	AlertResolved AlertState = "resolved"
+)
+
+var ErrInvalidAlertRule = errors.New("invalid alert rule")
+
+// AlertRule is a threshold condition on a field of the Products of the metrics.
+type AlertRule struct {
+	Name string
+	// Metric is the name or pattern of the metrics, e.g. "go:goroutines" or "http:*"
+	Metric string
+	// Series is the ID of the time series to evaluate, empty means all time series.
+	Series string
+	// Field is the field of the Value, see FieldValue.
+	Field string
+	// Op is one of >, >=, <, <=, ==, !=
+	Op        string
+	Threshold float64
+	// For is the number of consecutive bins the condition should be met for before firing.
+	// Less than 2 fires on the first bin.
+	For int
+
+	filter Filter
+}
+
+// ParseAlertRule parses a condition in the form of
+//
+//	<field> <op> <threshold> [for <n> bins]
+//
+// e.g. "p99 > 500ms for 3 bins". The threshold is a number or a duration,
+// which is converted into nanoseconds as the fields of the timer.
+func ParseAlertRule(name string, metric string, condition string) (*AlertRule, error) {
+	fields := strings.Fields(condition)
+	if len(fields) != 3 && len(fields) != 5 && len(fields) != 6 {
+		return nil, fmt.Errorf("%w %q: expects '<field> <op> <threshold> [for <n> bins]'", ErrInvalidAlertRule, condition)
+	}
+	rule := &AlertRule{
+		Name:   name,
+		Metric: metric,
+		Field:  fields[0],
+		Op:     fields[1],
+	}
+	threshold, err := parseThreshold(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w %q: threshold %q", ErrInvalidAlertRule, condition, fields[2])
+	}
+	rule.Threshold = threshold
+	if len(fields) > 3 {
+		if fields[3] != "for" || (len(fields) == 6 && fields[5] != "bins" && fields[5] != "bin") {
+			return nil, fmt.Errorf("%w %q: expects 'for <n> bins'", ErrInvalidAlertRule, condition)
+		}
+		n, err := strconv.Atoi(fields[4])
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("%w %q: invalid number of bins %q", ErrInvalidAlertRule, condition, fields[4])
+		}
+		rule.For = n
+	}
+	if err := rule.compile(); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+func parseThreshold(s string) (float64, error) {
+	if v, err := strconv.ParseFloat(s, 64); err == nil {
+		return v, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	return float64(d), nil
+}
+
+func (r *AlertRule) compile() error {
+	switch r.Op {
+	case ">", ">=", "<", "<=", "==", "!=":
+	default:
+		return fmt.Errorf("%w %q: unknown operator %q", ErrInvalidAlertRule, r.Name, r.Op)
+	}
+	if r.Field == "" {
+		return fmt.Errorf("%w %q: no field", ErrInvalidAlertRule, r.Name)
+	}
+	filter, err := Compile([]string{r.Metric}, ':')
+	if err != nil {
+		return fmt.Errorf("%w %q: %v", ErrInvalidAlertRule, r.Name, err)
+	}
+	r.filter = filter
+	return nil
+}
+
+// String returns the condition of the rule, e.g. "p99 > 5e+08 for 3 bins"
+func (r *AlertRule) String() string {
+	s := fmt.Sprintf("%s %s %g", r.Field, r.Op, r.Threshold)
+	if r.For > 1 {
+		s += fmt.Sprintf(" for %d bins", r.For)
+	}
+	return s
+}
+
+func (r *AlertRule) match(prd Product) bool {
+	if r.Series != "" && r.Series != prd.SeriesID {
+		return false
+	}
+	return r.filter.Match(prd.Name)
+}
+
+func (r *AlertRule) test(v float64) bool {
+	switch r.Op {
+	case ">":
+		return v > r.Threshold
+	case ">=":
+		return v >= r.Threshold
+	case "<":
+		return v < r.Threshold
+	case "<=":
+		return v <= r.Threshold
+	case "==":
+		return v == r.Threshold
+	default:
+		return v != r.Threshold
+	}
+}
+
+// AlertEvent is sent to the notifiers when an alert changes its state to firing or resolved.
+type AlertEvent struct {
+	Rule      string     `json:"rule"`
+	Condition string     `json:"condition"`
+	State     AlertState `json:"state"`
+	Name      string     `json:"name"`
+	Labels    Labels     `json:"labels,omitempty"`
+	SeriesID  string     `json:"series_id,omitempty"`
+	Value     float64    `json:"value"`
+	Unit      Unit       `json:"unit,omitempty"`
+	// Since is the time of the bin the condition was met first.
+	Since time.Time `json:"since"`
+	// Time is the time of the bin that changed the state.
+	Time time.Time `json:"ts"`
+}
+
+// Alert is the current state of a rule on a time series.
+type Alert struct {
+	AlertEvent
+	// Count is the number of consecutive bins the condition is met.
+	Count int `json:"count"`
+}
+
+// Notifier is notified of the alerts that change their state.
+type Notifier interface {
+	Notify(AlertEvent) error
+}
+
+// NotifierFunc is a function type that implements Notifier.
+type NotifierFunc func(AlertEvent) error
+
+var _ Notifier = NotifierFunc(nil)
+
+func (f NotifierFunc) Notify(ev AlertEvent) error {
+	return f(ev)
+}
+
+// SlogNotifier logs the alerts, firing alerts at warn level and resolved ones at info level.
+type SlogNotifier struct {
+	Logger *slog.Logger // nil uses slog.Default()
+}
+
+var _ Notifier = (*SlogNotifier)(nil)
+
+func (sn *SlogNotifier) Notify(ev AlertEvent) error {
+	logger := sn.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	level := slog.LevelInfo
+	if ev.State == AlertFiring {
+		level = slog.LevelWarn
+	}
+	logger.Log(context.Background(), level, "Alert "+string(ev.State),
+		"rule", ev.Rule, "condition", ev.Condition, "name", SeriesKey(ev.Name, ev.Labels),
+		"series", ev.SeriesID, "value", ev.Value, "since", ev.Since)
+	return nil
+}
+
+// WebhookNotifier posts the alerts to the URL as JSON.
+type WebhookNotifier struct {
+	URL    string
+	Header http.Header
+	Client *http.Client // nil uses a client with 10 seconds of timeout
+}
+
+var _ Notifier = (*WebhookNotifier)(nil)
+
+var defaultWebhookClient = &http.Client{Timeout: 10 * time.Second}
+
+func (wn *WebhookNotifier) Notify(ev AlertEvent) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, wn.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range wn.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := wn.Client
+	if client == nil {
+		client = defaultWebhookClient
+	}
+	rsp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s: %s", wn.URL, rsp.Status)
+	}
+	return nil
+}
+
+// AlertEngine evaluates the alert rules on the Products and notifies the state changes.
+// It is an Output, so it is fed by the collector when it is added by AddOutput().
+//
+// An alert becomes pending when the condition is met, firing when it is met
+// for the number of consecutive bins of the rule, and resolved when it is no longer met.
+// Only the changes to firing and resolved are notified, so a firing alert is notified once.
+// Null Products and the Values without the field do not change the state of the alerts.
+//
+// The notifiers are called in Process(), wrap the engine with NewAsyncOutput
+// if a notifier may be slow, e.g. a webhook.
+type AlertEngine struct {
+	mu        sync.Mutex
+	rules     []*AlertRule
+	notifiers []Notifier
+	alerts    map[alertKey]*Alert
+}
+
+type alertKey struct {
+	rule   *AlertRule
+	key    string
+	series string
+}
+
+var _ Output = (*AlertEngine)(nil)
+
+func NewAlertEngine(notifiers ...Notifier) *AlertEngine {
+	return &AlertEngine{
+		notifiers: notifiers,
+		alerts:    make(map[alertKey]*Alert),
+	}
+}
+
+// AddRule adds the rule to the engine.
+func (ae *AlertEngine) AddRule(rule *AlertRule) error {
+	if err := rule.compile(); err != nil {
+		return err
+	}
+	ae.mu.Lock()
+	defer ae.mu.Unlock()
+	ae.rules = append(ae.rules, rule)
+	return nil
+}
+
+// AddNotifier adds the notifier to the engine.
+func (ae *AlertEngine) AddNotifier(n Notifier) {
+	ae.mu.Lock()
+	defer ae.mu.Unlock()
+	ae.notifiers = append(ae.notifiers, n)
+}
+
+// Alerts returns the pending and firing alerts.
+func (ae *AlertEngine) Alerts() []Alert {
+	ae.mu.Lock()
+	defer ae.mu.Unlock()
+	ret := make([]Alert, 0, len(ae.alerts))
+	for _, a := range ae.alerts {
+		ret = append(ret, *a)
+	}
+	return ret
+}
+
+func (ae *AlertEngine) Process(prd Product) error {
+	if prd.IsNull || prd.Value == nil {
+		return nil
+	}
+	var events []AlertEvent
+	ae.mu.Lock()
+	for _, rule := range ae.rules {
+		if !rule.match(prd) {
+			continue
+		}
+		v, ok := FieldValue(prd.Value, rule.Field)
+		if !ok || math.IsNaN(v) {
+			continue
+		}
+		if ev, ok := ae.evaluate(rule, prd, v); ok {
+			events = append(events, ev)
+		}
+	}
+	notifiers := ae.notifiers
+	ae.mu.Unlock()
+
+	for _, ev := range events {
+		for _, n := range notifiers {
+			if err := n.Notify(ev); err != nil {
+				slog.Error("Error notifying alert", "rule", ev.Rule, "state", ev.State, "error", err)
+			}
+		}
+	}
+	return nil
+}
+
+// evaluate updates the alert of the rule on the series of the Product,
+// it returns the event to be notified if the alert changes to firing or resolved.
+func (ae *AlertEngine) evaluate(rule *AlertRule, prd Product, v float64) (AlertEvent, bool) {
+	k := alertKey{rule: rule, key: prd.Key(), series: prd.SeriesID}
+	a := ae.alerts[k]
+	if !rule.test(v) {
+		if a == nil {
+			return AlertEvent{}, false
+		}
+		delete(ae.alerts, k)
+		if a.State != AlertFiring {
+			return AlertEvent{}, false
+		}
+		ev := a.AlertEvent
+		ev.State, ev.Value, ev.Time = AlertResolved, v, prd.Time
+		return ev, true
+	}
+	if a == nil {
+		a = &Alert{AlertEvent: AlertEvent{
+			Rule:      rule.Name,
+			Condition: rule.String(),
+			State:     AlertPending,
+			Name:      prd.Name,
+			Labels:    prd.Labels,
+			SeriesID:  prd.SeriesID,
+			Unit:      prd.Unit,
+			Since:     prd.Time,
+		}}
+		ae.alerts[k] = a
+	}
+	a.Count++
+	a.Value, a.Time = v, prd.Time
+	if a.State == AlertPending && a.Count >= max(rule.For, 1) {
+		a.State = AlertFiring
+		return a.AlertEvent, true
+	}
+	return AlertEvent{}, false
+}
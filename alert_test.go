@@ -0,0 +1,132 @@
+package metric
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFieldValue(t *testing.T) {
+	v, ok := FieldValue(&GaugeValue{Samples: 2, Sum: 10, Value: 6}, "avg")
+	require.True(t, ok)
+	require.Equal(t, 5.0, v)
+
+	v, ok = FieldValue(&TimerValue{Samples: 2, Sum: 3 * time.Second, Max: 2 * time.Second}, "max")
+	require.True(t, ok)
+	require.Equal(t, float64(2*time.Second), v)
+
+	v, ok = FieldValue(&HistogramValue{Samples: 10, P: []float64{0.5, 0.99, 0.999}, Values: []float64{1, 2, 3}}, "p999")
+	require.True(t, ok)
+	require.Equal(t, 3.0, v)
+
+	v, ok = FieldValue(&CounterValue{Samples: 1, Value: 3, DerivedValues: map[string]Value{
+		"ma5": &CounterValue{Samples: 5, Value: 2},
+	}}, "ma5.value")
+	require.True(t, ok)
+	require.Equal(t, 2.0, v)
+
+	_, ok = FieldValue(&GaugeValue{}, "avg")
+	require.False(t, ok, "no samples")
+	_, ok = FieldValue(&GaugeValue{Samples: 1}, "p99")
+	require.False(t, ok, "unknown field")
+}
+
+func TestParseAlertRule(t *testing.T) {
+	r, err := ParseAlertRule("slow", "http:latency", "p99 > 500ms for 3 bins")
+	require.NoError(t, err)
+	require.Equal(t, "p99", r.Field)
+	require.Equal(t, ">", r.Op)
+	require.Equal(t, float64(500*time.Millisecond), r.Threshold)
+	require.Equal(t, 3, r.For)
+	require.Equal(t, "p99 > 5e+08 for 3 bins", r.String())
+
+	r, err = ParseAlertRule("busy", "cpu:*", "avg >= 90")
+	require.NoError(t, err)
+	require.Equal(t, 90.0, r.Threshold)
+	require.Equal(t, 0, r.For)
+
+	for _, cond := range []string{"p99 > ", "p99 ~ 1", "p99 > x", "p99 > 1 for x bins", "p99 > 1 during 3 bins"} {
+		_, err = ParseAlertRule("bad", "m", cond)
+		require.ErrorIs(t, err, ErrInvalidAlertRule, cond)
+	}
+}
+
+func TestAlertEngine(t *testing.T) {
+	var events []AlertEvent
+	ae := NewAlertEngine(NotifierFunc(func(ev AlertEvent) error {
+		events = append(events, ev)
+		return nil
+	}))
+	rule, err := ParseAlertRule("high", "cpu:*", "last > 80 for 3 bins")
+	require.NoError(t, err)
+	require.NoError(t, ae.AddRule(rule))
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	feed := func(name string, value float64) {
+		now = now.Add(time.Second)
+		require.NoError(t, ae.Process(Product{Name: name, Time: now, SeriesID: "1s",
+			Value: &GaugeValue{Samples: 1, Sum: value, Value: value}}))
+	}
+
+	feed("cpu:user", 90)
+	feed("cpu:user", 90)
+	require.Empty(t, events)
+	require.Len(t, ae.Alerts(), 1)
+	require.Equal(t, AlertPending, ae.Alerts()[0].State)
+
+	// null Products do not change the state
+	require.NoError(t, ae.Process(Product{Name: "cpu:user", SeriesID: "1s", IsNull: true}))
+	// the other metrics do not match
+	feed("mem:used", 90)
+
+	feed("cpu:user", 95)
+	require.Len(t, events, 1)
+	require.Equal(t, AlertFiring, events[0].State)
+	require.Equal(t, "cpu:user", events[0].Name)
+	require.Equal(t, 95.0, events[0].Value)
+	require.Equal(t, now.Add(-3*time.Second), events[0].Since)
+
+	// deduplicated while firing
+	feed("cpu:user", 99)
+	require.Len(t, events, 1)
+	require.Equal(t, 4, ae.Alerts()[0].Count)
+
+	feed("cpu:user", 10)
+	require.Len(t, events, 2)
+	require.Equal(t, AlertResolved, events[1].State)
+	require.Equal(t, 10.0, events[1].Value)
+	require.Empty(t, ae.Alerts())
+
+	// pending alerts are cleared silently
+	feed("cpu:user", 90)
+	feed("cpu:user", 10)
+	require.Len(t, events, 2)
+	require.Empty(t, ae.Alerts())
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	received := make(chan AlertEvent, 1)
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.Equal(t, "secret", r.Header.Get("X-Token"))
+		var ev AlertEvent
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&ev))
+		received <- ev
+	}))
+	defer svr.Close()
+
+	wn := &WebhookNotifier{URL: svr.URL, Header: http.Header{"X-Token": {"secret"}}}
+	require.NoError(t, wn.Notify(AlertEvent{Rule: "high", State: AlertFiring, Name: "cpu:user", Value: 95}))
+	ev := <-received
+	require.Equal(t, "high", ev.Rule)
+	require.Equal(t, AlertFiring, ev.State)
+	require.Equal(t, 95.0, ev.Value)
+
+	wn.URL = svr.URL + "/missing"
+	svr.Config.Handler = http.NotFoundHandler()
+	require.Error(t, wn.Notify(AlertEvent{Rule: "high"}))
+}
@@ -0,0 +1,179 @@
+package metric
+
+import (
+	"encoding/json"
+	"math"
+	"slices"
+)
+
+// the scale of the median absolute deviation to the standard deviation of the normal distribution
+const madScale = 1.4826
+
+// NewMADAnomaly returns a Deriver that flags the current bin as an anomaly
+// if its robust z-score, the distance from the median in the scaled median absolute deviations
+// of the windowSize bins before the current one, exceeds the threshold, e.g. 3.5.
+func NewMADAnomaly(id string, windowSize int, threshold float64, opts ...AnomalyOption) Deriver {
+	a := &Anomaly{id: id, windowSize: max(windowSize, 3), threshold: threshold}
+	for _, o := range opts {
+		o(a)
+	}
+	return a
+}
+
+// NewSeasonalAnomaly returns a Deriver that compares the current bin with the bins of the same phase
+// in the previous seasons of the season in bins, e.g. 24 for the daily season of hourly bins.
+// The baseline is the median of the bins of the same phase, and the score is the distance from it
+// in the scaled median absolute deviations of the seasonal differences of the window of the seasons,
+// so that a daily pattern is not an anomaly.
+func NewSeasonalAnomaly(id string, season int, seasons int, threshold float64, opts ...AnomalyOption) Deriver {
+	a := &Anomaly{id: id, season: max(season, 1), threshold: threshold}
+	a.windowSize = a.season * max(seasons, 1)
+	for _, o := range opts {
+		o(a)
+	}
+	return a
+}
+
+type AnomalyOption func(*Anomaly)
+
+// AnomalyField sets the field of the values to inspect, default is the primary field, see FieldValue.
+func AnomalyField(field string) AnomalyOption {
+	return func(a *Anomaly) {
+		a.field = field
+	}
+}
+
+var _ Deriver = Anomaly{}
+
+// Anomaly derives an AnomalyValue of the current bin relative to the history bins before it.
+// The null bins and the bins without samples are skipped.
+// The derived values can be fed into AlertEngine by the fields, e.g. "anomaly.anomaly == 1"
+// or "anomaly.abs_score > 5", see FieldValue.
+type Anomaly struct {
+	id         string
+	field      string
+	windowSize int // number of the history bins
+	season     int // zero for MAD over the window
+	threshold  float64
+}
+
+func (a Anomaly) ID() string {
+	return a.id
+}
+
+// WindowSize is the number of the history bins and the current one.
+func (a Anomaly) WindowSize() int {
+	return a.windowSize + 1
+}
+
+func (a Anomaly) Derive(values []Value) Value {
+	ret := &AnomalyValue{}
+	if len(values) == 0 {
+		return ret
+	}
+	x, ok := primaryFieldValue(values[len(values)-1], a.field)
+	if !ok {
+		return ret
+	}
+	ret.Value = x
+	history := values[:len(values)-1]
+	var spread float64
+	if a.season > 0 {
+		ret.Baseline, spread, ret.Bins = a.seasonal(history)
+	} else {
+		ret.Baseline, spread, ret.Bins = a.mad(history)
+	}
+	if ret.Bins == 0 {
+		return ret
+	}
+	// the spread of the rounding errors of a flat history is zero
+	if spread > 1e-9*max(math.Abs(ret.Baseline), 1) {
+		ret.Score = (x - ret.Baseline) / spread
+		ret.Anomaly = math.Abs(ret.Score) > a.threshold
+	} else {
+		// any change of a flat history is an anomaly
+		ret.Anomaly = x != ret.Baseline
+	}
+	return ret
+}
+
+// mad returns the median and the scaled median absolute deviation of the history,
+// which should have at least three bins.
+func (a Anomaly) mad(history []Value) (float64, float64, int) {
+	var xs []float64
+	for _, v := range history {
+		if x, ok := primaryFieldValue(v, a.field); ok {
+			xs = append(xs, x)
+		}
+	}
+	if len(xs) < 3 {
+		return 0, 0, 0
+	}
+	med := median(xs)
+	dev := make([]float64, len(xs))
+	for i, x := range xs {
+		dev[i] = math.Abs(x - med)
+	}
+	return med, madScale * median(dev), len(xs)
+}
+
+// seasonal returns the median of the bins of the same phase as the current one,
+// and the scaled median absolute deviation of the seasonal differences of the history.
+func (a Anomaly) seasonal(history []Value) (float64, float64, int) {
+	n := len(history)
+	xs := make([]float64, n)
+	oks := make([]bool, n)
+	var bins int
+	for i, v := range history {
+		xs[i], oks[i] = primaryFieldValue(v, a.field)
+		if oks[i] {
+			bins++
+		}
+	}
+	var phase []float64
+	for i := n - a.season; i >= 0; i -= a.season {
+		if oks[i] {
+			phase = append(phase, xs[i])
+		}
+	}
+	var diffs []float64
+	for i := a.season; i < n; i++ {
+		if oks[i] && oks[i-a.season] {
+			diffs = append(diffs, xs[i]-xs[i-a.season])
+		}
+	}
+	if len(phase) == 0 || len(diffs) < 3 {
+		return 0, 0, 0
+	}
+	base := median(phase)
+	med := median(diffs)
+	for i, d := range diffs {
+		diffs[i] = math.Abs(d - med)
+	}
+	return base, madScale * median(diffs), bins
+}
+
+// median returns the median of xs, which is reordered.
+func median(xs []float64) float64 {
+	slices.Sort(xs)
+	n := len(xs)
+	if n%2 == 1 {
+		return xs[n/2]
+	}
+	return (xs[n/2-1] + xs[n/2]) / 2
+}
+
+// AnomalyValue is the value of Anomaly.
+// Score is zero if the history does not vary, then any other value is an anomaly.
+type AnomalyValue struct {
+	Bins     int     `json:"bins"`  // number of the history bins with samples
+	Value    float64 `json:"value"` // value of the current bin
+	Baseline float64 `json:"baseline"`
+	Score    float64 `json:"score"`
+	Anomaly  bool    `json:"anomaly"`
+}
+
+func (av *AnomalyValue) String() string {
+	b, _ := json.Marshal(av)
+	return string(b)
+}
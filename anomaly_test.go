@@ -0,0 +1,122 @@
+package metric
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func gaugeValues(xs ...float64) []Value {
+	ret := make([]Value, len(xs))
+	for i, x := range xs {
+		ret[i] = &GaugeValue{Samples: 1, Sum: x, Value: x}
+	}
+	return ret
+}
+
+func TestMADAnomaly(t *testing.T) {
+	a := NewMADAnomaly("anom", 6, 3.5)
+	require.Equal(t, 7, a.WindowSize())
+
+	av := a.Derive(gaugeValues(10, 11, 9, 10, 12, 8, 30)).(*AnomalyValue)
+	require.Equal(t, 6, av.Bins)
+	require.Equal(t, 10.0, av.Baseline)
+	require.InDelta(t, 20/(madScale*1), av.Score, 1e-9)
+	require.True(t, av.Anomaly)
+
+	av = a.Derive(gaugeValues(10, 11, 9, 10, 12, 8, 11)).(*AnomalyValue)
+	require.False(t, av.Anomaly)
+
+	// a single outlier in the history does not hide the next one
+	av = a.Derive(gaugeValues(10, 11, 9, 100, 12, 8, 40)).(*AnomalyValue)
+	require.True(t, av.Anomaly)
+
+	// flat history
+	av = a.Derive(gaugeValues(5, 5, 5, 5, 6)).(*AnomalyValue)
+	require.Equal(t, 0.0, av.Score)
+	require.True(t, av.Anomaly)
+
+	// not enough history
+	av = a.Derive(append([]Value{nil, &GaugeValue{}}, gaugeValues(1, 2, 3)...)).(*AnomalyValue)
+	require.Equal(t, 0, av.Bins)
+	require.False(t, av.Anomaly)
+	_, ok := FieldValue(av, "anomaly")
+	require.False(t, ok)
+}
+
+func TestSeasonalAnomaly(t *testing.T) {
+	const season = 8
+	r := rand.New(rand.NewPCG(1, 2))
+	daily := func(i int) float64 {
+		return 50 + 40*math.Sin(2*math.Pi*float64(i)/season) + r.NormFloat64()
+	}
+	var xs []float64
+	for i := range 4*season + 1 {
+		xs = append(xs, daily(i))
+	}
+	a := NewSeasonalAnomaly("anom", season, 4, 4)
+	require.Equal(t, 4*season+1, a.WindowSize())
+
+	// the peak of the day is not an anomaly
+	peak := 2*season + season/4
+	window := gaugeValues(xs[peak-2*season : peak+1]...)
+	av := a.Derive(window).(*AnomalyValue)
+	require.False(t, av.Anomaly, "%+v", av)
+
+	// the peak at night is
+	xs[len(xs)-1] = 90
+	av = a.Derive(gaugeValues(xs...)).(*AnomalyValue)
+	require.True(t, av.Anomaly, "%+v", av)
+	require.Equal(t, 4*season, av.Bins)
+	v, ok := FieldValue(av, "abs_score")
+	require.True(t, ok)
+	require.Greater(t, v, 4.0)
+}
+
+func TestAnomalyAlert(t *testing.T) {
+	var events []AlertEvent
+	ae := NewAlertEngine(NotifierFunc(func(ev AlertEvent) error {
+		events = append(events, ev)
+		return nil
+	}))
+	rule, err := ParseAlertRule("anomaly", "latency", "anom.anomaly == 1")
+	require.NoError(t, err)
+	require.NoError(t, ae.AddRule(rule))
+
+	sid, err := NewSeriesID("SEC", "1 sec.", time.Second, 20)
+	require.NoError(t, err)
+	clk := NewFakeClock(time.Date(2025, 07, 21, 17, 31, 12, 0, time.UTC))
+	ts := NewTimeSeries(time.Second, 20, NewGauge().WithDerivers(NewMADAnomaly("anom", 10, 3.5)),
+		WithTimeSeriesClock(clk),
+		WithMeta(SeriesInfo{MeasureName: "latency", MeasureType: GaugeType(UnitDuration), SeriesID: sid}),
+		WithListener(func(p Product) { require.NoError(t, ae.Process(p)) }),
+	)
+	for i, x := range []float64{10, 11, 9, 10, 12, 8, 10, 11, 9, 10, 50, 10} {
+		ts.Add(x)
+		clk.Advance(time.Second)
+		if i < 10 {
+			require.Empty(t, events)
+		}
+	}
+	ts.Add(10)
+	require.Len(t, events, 2)
+	require.Equal(t, AlertFiring, events[0].State)
+	require.Equal(t, AlertResolved, events[1].State)
+
+	_, values := ts.LastN(0)
+	ss := Snapshot{Times: make([]time.Time, len(values)), Values: values,
+		Meta: SeriesInfo{MeasureName: "latency", MeasureType: GaugeType(UnitDuration)}}
+	series := ss.derivedToSeries(Chart{})
+	require.Len(t, series, 1)
+	require.Equal(t, "scatter", series[0].Type)
+	var marks []any
+	for _, itm := range series[0].Data {
+		if itm.Value != nil {
+			marks = append(marks, itm.Value)
+		}
+	}
+	require.Equal(t, []any{50.0}, marks)
+}
@@ -0,0 +1,215 @@
+package metric
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds of the buckets of Prometheus' default histogram.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// BucketHistogram counts the values in the buckets of fixed upper bounds,
+// like the histogram of Prometheus. A value is counted in the first bucket
+// whose bound is greater than or equal to the value, a value greater than
+// all bounds is counted in the +Inf bucket.
+type BucketHistogram struct {
+	sync.Mutex
+	bounds   []float64
+	counts   []int64 // counts of each bucket, the last one is +Inf
+	samples  int64
+	sum      float64
+	derivers []Deriver
+}
+
+var _ Producer = (*BucketHistogram)(nil)
+var _ Merger = (*BucketHistogram)(nil)
+
+// NewBucketHistogram returns a BucketHistogram of the upper bounds, which are sorted
+// and deduplicated. If no bounds are given, DefaultBuckets is used.
+func NewBucketHistogram(bounds ...float64) *BucketHistogram {
+	if len(bounds) == 0 {
+		bounds = DefaultBuckets
+	}
+	bounds = slices.Clone(bounds)
+	slices.Sort(bounds)
+	bounds = slices.Compact(bounds)
+	// the +Inf bucket is implied
+	if math.IsInf(bounds[len(bounds)-1], 1) {
+		bounds = bounds[:len(bounds)-1]
+	}
+	return &BucketHistogram{
+		bounds: bounds,
+		counts: make([]int64, len(bounds)+1),
+	}
+}
+
+func (h *BucketHistogram) WithDerivers(derivers ...Deriver) *BucketHistogram {
+	h.derivers = append(h.derivers, derivers...)
+	return h
+}
+
+func (h *BucketHistogram) Derivers() []Deriver {
+	return h.derivers
+}
+
+func (h *BucketHistogram) Add(v float64) {
+	if math.IsNaN(v) {
+		return
+	}
+	h.Lock()
+	defer h.Unlock()
+	h.counts[sort.SearchFloat64s(h.bounds, v)]++
+	h.samples++
+	h.sum += v
+}
+
+// Merge adds the counts of a BucketHistogramValue of the same bounds.
+func (h *BucketHistogram) Merge(v Value) error {
+	bv, ok := v.(*BucketHistogramValue)
+	if !ok {
+		return fmt.Errorf("%w: %T into bucket histogram", ErrNotMergeable, v)
+	}
+	if bv.Samples == 0 {
+		return nil
+	}
+	h.Lock()
+	defer h.Unlock()
+	if !slices.Equal(h.bounds, bv.Bounds) || len(bv.Counts) != len(h.counts) {
+		return fmt.Errorf("%w: bucket histogram of different bounds", ErrNotMergeable)
+	}
+	var prev int64
+	for i, c := range bv.Counts {
+		h.counts[i] += c - prev
+		prev = c
+	}
+	h.samples += bv.Samples
+	h.sum += bv.Sum
+	return nil
+}
+
+func (h *BucketHistogram) Produce(reset bool) Value {
+	h.Lock()
+	defer h.Unlock()
+	ret := &BucketHistogramValue{
+		Samples: h.samples,
+		Sum:     h.sum,
+		Bounds:  h.bounds,
+		Counts:  make([]int64, len(h.counts)),
+	}
+	var cum int64
+	for i, c := range h.counts {
+		cum += c
+		ret.Counts[i] = cum
+	}
+	if reset {
+		h.counts = make([]int64, len(h.bounds)+1)
+		h.samples = 0
+		h.sum = 0
+	}
+	return ret
+}
+
+func (h *BucketHistogram) String() string {
+	return h.Produce(false).String()
+}
+
+func (h *BucketHistogram) MarshalJSON() ([]byte, error) {
+	h.Lock()
+	defer h.Unlock()
+	return json.Marshal(map[string]any{
+		"bounds":  h.bounds,
+		"counts":  h.counts,
+		"samples": h.samples,
+		"sum":     h.sum,
+	})
+}
+
+func (h *BucketHistogram) UnmarshalJSON(data []byte) error {
+	var obj struct {
+		Bounds  []float64 `json:"bounds"`
+		Counts  []int64   `json:"counts"`
+		Samples int64     `json:"samples"`
+		Sum     float64   `json:"sum"`
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	if len(obj.Counts) != len(obj.Bounds)+1 {
+		return fmt.Errorf("bucket histogram: %d counts for %d bounds", len(obj.Counts), len(obj.Bounds))
+	}
+	h.bounds = obj.Bounds
+	h.counts = obj.Counts
+	h.samples = obj.Samples
+	h.sum = obj.Sum
+	return nil
+}
+
+// BucketHistogramValue is the value of BucketHistogram.
+// Counts are cumulative as the "le" buckets of Prometheus,
+// Counts[i] is the number of values less than or equal to Bounds[i],
+// and the last one, which is of the +Inf bucket, equals to Samples.
+type BucketHistogramValue struct {
+	Samples int64     `json:"samples"`
+	Sum     float64   `json:"sum"`
+	Bounds  []float64 `json:"bounds"`
+	Counts  []int64   `json:"counts"`
+
+	// Optional derived values, such as moving averages
+	DerivedValues DerivedValues `json:"derived,omitempty"`
+}
+
+func (bv *BucketHistogramValue) String() string {
+	b, _ := json.Marshal(bv)
+	return string(b)
+}
+
+func (bv *BucketHistogramValue) SetDerivedValue(name string, value Value) {
+	if bv.DerivedValues == nil {
+		bv.DerivedValues = make(DerivedValues)
+	}
+	bv.DerivedValues[name] = value
+}
+
+// BucketNames returns the field names of the buckets, e.g. le_0.5 and le_inf.
+func (bv *BucketHistogramValue) BucketNames() []string {
+	ret := make([]string, len(bv.Bounds)+1)
+	for i, b := range bv.Bounds {
+		ret[i] = "le_" + strconv.FormatFloat(b, 'g', -1, 64)
+	}
+	ret[len(bv.Bounds)] = "le_inf"
+	return ret
+}
+
+// Quantile estimates the quantile q in [0, 1] by the linear interpolation
+// in the bucket, as histogram_quantile() of Prometheus.
+// It returns the highest bound if the quantile falls in the +Inf bucket,
+// and NaN if there are no samples.
+func (bv *BucketHistogramValue) Quantile(q float64) float64 {
+	if bv.Samples == 0 || len(bv.Counts) == 0 || q < 0 || q > 1 {
+		return math.NaN()
+	}
+	rank := q * float64(bv.Counts[len(bv.Counts)-1])
+	i := sort.Search(len(bv.Counts), func(i int) bool { return float64(bv.Counts[i]) >= rank })
+	if i >= len(bv.Bounds) {
+		if len(bv.Bounds) == 0 {
+			return math.NaN()
+		}
+		return bv.Bounds[len(bv.Bounds)-1]
+	}
+	lower, prev := 0.0, int64(0)
+	if i > 0 {
+		lower, prev = bv.Bounds[i-1], bv.Counts[i-1]
+	} else if bv.Bounds[0] <= 0 {
+		return bv.Bounds[0]
+	}
+	count := bv.Counts[i] - prev
+	if count == 0 {
+		return bv.Bounds[i]
+	}
+	return lower + (bv.Bounds[i]-lower)*(rank-float64(prev))/float64(count)
+}
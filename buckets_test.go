@@ -0,0 +1,96 @@
+package metric
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBucketHistogram(t *testing.T) {
+	h := NewBucketHistogram(10, 1, 5, 5, math.Inf(1))
+	for _, v := range []float64{0.5, 1, 2, 5, 7, 10, 100, math.NaN()} {
+		h.Add(v)
+	}
+	v := h.Produce(true).(*BucketHistogramValue)
+	require.Equal(t, int64(7), v.Samples)
+	require.Equal(t, 125.5, v.Sum)
+	require.Equal(t, []float64{1, 5, 10}, v.Bounds)
+	require.Equal(t, []int64{2, 4, 6, 7}, v.Counts)
+	require.Equal(t, []string{"le_1", "le_5", "le_10", "le_inf"}, v.BucketNames())
+	require.Equal(t, int64(0), h.Produce(false).(*BucketHistogramValue).Samples)
+
+	require.Equal(t, DefaultBuckets, NewBucketHistogram().Produce(false).(*BucketHistogramValue).Bounds)
+}
+
+func TestBucketHistogramQuantile(t *testing.T) {
+	h := NewBucketHistogram(10, 20, 30, 40)
+	for i := 1; i <= 40; i++ {
+		h.Add(float64(i))
+	}
+	v := h.Produce(false).(*BucketHistogramValue)
+	require.Equal(t, 5.0, v.Quantile(0.125))
+	require.Equal(t, 20.0, v.Quantile(0.5))
+	require.Equal(t, 36.0, v.Quantile(0.9))
+
+	// the +Inf bucket returns the highest bound
+	h.Add(1000)
+	h.Add(1000)
+	require.Equal(t, 40.0, h.Produce(false).(*BucketHistogramValue).Quantile(0.99))
+	require.True(t, math.IsNaN((&BucketHistogramValue{}).Quantile(0.5)))
+}
+
+func TestBucketHistogramMerge(t *testing.T) {
+	a := NewBucketHistogram(1, 5, 10)
+	b := NewBucketHistogram(1, 5, 10)
+	all := NewBucketHistogram(1, 5, 10)
+	for i := range 20 {
+		a.Add(float64(i))
+		b.Add(float64(i) / 2)
+		all.Add(float64(i))
+		all.Add(float64(i) / 2)
+	}
+	require.NoError(t, a.Merge(b.Produce(false)))
+	require.Equal(t, all.Produce(false), a.Produce(false))
+
+	// an empty value is ignored
+	require.NoError(t, a.Merge(NewBucketHistogram(2).Produce(false)))
+	c := NewBucketHistogram(2)
+	c.Add(1)
+	require.ErrorIs(t, a.Merge(c.Produce(false)), ErrNotMergeable)
+	require.ErrorIs(t, a.Merge(&GaugeValue{Samples: 1}), ErrNotMergeable)
+
+	// moving average merges the window
+	ma := NewMovingAverage("ma2", 2)
+	mv := ma.Derive([]Value{a.Produce(false), b.Produce(false)}).(*BucketHistogramValue)
+	require.Equal(t, int64(60), mv.Samples)
+	require.Equal(t, []int64{8, 28, 51, 60}, mv.Counts)
+}
+
+func TestBucketHistogramJSON(t *testing.T) {
+	h := NewBucketHistogram(1, 5)
+	h.Add(0.5)
+	h.Add(3)
+	h.Add(30)
+	b, err := json.Marshal(h)
+	require.NoError(t, err)
+	var h2 BucketHistogram
+	require.NoError(t, json.Unmarshal(b, &h2))
+	require.Equal(t, h.Produce(false), h2.Produce(false))
+
+	require.Error(t, json.Unmarshal([]byte(`{"bounds":[1],"counts":[1]}`), &h2))
+
+	var pd Product
+	b, err = json.Marshal(map[string]any{"name": "latency", "type": "bucket_histogram", "value": h.Produce(false)})
+	require.NoError(t, err)
+	require.NoError(t, parseProduct(&pd, string(b), true))
+	require.Equal(t, h.Produce(false), pd.Value)
+
+	v, ok := FieldValue(pd.Value, "le_5")
+	require.True(t, ok)
+	require.Equal(t, 2.0, v)
+	v, ok = FieldValue(pd.Value, "p50")
+	require.True(t, ok)
+	require.Equal(t, 3.0, v)
+}
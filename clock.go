@@ -0,0 +1,170 @@
+package metric
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock provides the time and the timers to the collector and the time series,
+// so that they can run in virtual time by FakeClock.
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+	After(d time.Duration) <-chan time.Time
+}
+
+// Ticker is the ticker of a Clock, see time.Ticker.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// SystemClock returns the Clock of the package time.
+func SystemClock() Clock {
+	return systemClock{}
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// FakeClock is a Clock that moves only by Advance() and Set().
+// The tickers and the timers of After() fire while the clock moves past their time,
+// a ticker drops the ticks that are not received like time.Ticker does.
+type FakeClock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+var _ Clock = (*FakeClock)(nil)
+
+type fakeWaiter struct {
+	clock  *FakeClock
+	ch     chan time.Time
+	at     time.Time
+	period time.Duration // zero for After()
+}
+
+// NewFakeClock returns a FakeClock that starts at now.
+func NewFakeClock(now time.Time) *FakeClock {
+	fc := &FakeClock{now: now}
+	fc.cond = sync.NewCond(&fc.mu)
+	return fc
+}
+
+func (fc *FakeClock) Now() time.Time {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.now
+}
+
+func (fc *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("metric: non-positive interval for FakeClock.NewTicker")
+	}
+	return fc.addWaiter(d, d)
+}
+
+func (fc *FakeClock) After(d time.Duration) <-chan time.Time {
+	return fc.addWaiter(d, 0).ch
+}
+
+func (fc *FakeClock) addWaiter(d time.Duration, period time.Duration) *fakeWaiter {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	w := &fakeWaiter{clock: fc, ch: make(chan time.Time, 1), at: fc.now.Add(d), period: period}
+	if d <= 0 {
+		w.ch <- fc.now
+		return w
+	}
+	fc.waiters = append(fc.waiters, w)
+	fc.cond.Broadcast()
+	return w
+}
+
+// Advance moves the clock forward by d.
+func (fc *FakeClock) Advance(d time.Duration) {
+	fc.Set(fc.Now().Add(d))
+}
+
+// Set moves the clock to t, the clock does not go backward.
+func (fc *FakeClock) Set(t time.Time) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	for {
+		var next *fakeWaiter
+		for _, w := range fc.waiters {
+			if !w.at.After(t) && (next == nil || w.at.Before(next.at)) {
+				next = w
+			}
+		}
+		if next == nil {
+			break
+		}
+		if next.at.After(fc.now) {
+			fc.now = next.at
+		}
+		select {
+		case next.ch <- next.at:
+		default:
+		}
+		if next.period > 0 {
+			next.at = next.at.Add(next.period)
+		} else {
+			fc.remove(next)
+		}
+	}
+	if t.After(fc.now) {
+		fc.now = t
+	}
+}
+
+// BlockUntil waits until n tickers and timers are waiting for the clock,
+// so that a test can advance the clock after the goroutines under test set up their timers.
+func (fc *FakeClock) BlockUntil(n int) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	for len(fc.waiters) < n {
+		fc.cond.Wait()
+	}
+}
+
+func (fc *FakeClock) remove(w *fakeWaiter) {
+	for i, x := range fc.waiters {
+		if x == w {
+			fc.waiters = append(fc.waiters[:i], fc.waiters[i+1:]...)
+			fc.cond.Broadcast()
+			return
+		}
+	}
+}
+
+func (w *fakeWaiter) C() <-chan time.Time {
+	return w.ch
+}
+
+func (w *fakeWaiter) Stop() {
+	w.clock.mu.Lock()
+	defer w.clock.mu.Unlock()
+	w.clock.remove(w)
+}
@@ -0,0 +1,49 @@
+package metric
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	fc := NewFakeClock(start)
+	require.Equal(t, start, fc.Now())
+
+	ticker := fc.NewTicker(time.Second)
+	after := fc.After(1500 * time.Millisecond)
+	fc.BlockUntil(2)
+
+	fc.Advance(time.Second)
+	require.Equal(t, start.Add(time.Second), <-ticker.C())
+	select {
+	case <-after:
+		t.Fatal("fired early")
+	default:
+	}
+
+	// the ticks that are not received are dropped
+	fc.Advance(2 * time.Second)
+	require.Equal(t, start.Add(1500*time.Millisecond), <-after)
+	require.Equal(t, start.Add(2*time.Second), <-ticker.C())
+	select {
+	case <-ticker.C():
+		t.Fatal("tick should be dropped")
+	default:
+	}
+	require.Equal(t, start.Add(3*time.Second), fc.Now())
+
+	ticker.Stop()
+	fc.Advance(time.Second)
+	select {
+	case <-ticker.C():
+		t.Fatal("stopped ticker")
+	default:
+	}
+
+	// never goes backward
+	fc.Set(start)
+	require.Equal(t, start.Add(4*time.Second), fc.Now())
+}
@@ -0,0 +1,570 @@
+package metric
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the declarative configuration of a collector and its dashboard.
+// It can be loaded from a YAML or JSON file by LoadConfig, e.g.
+//
+//	sampling_interval: 10s
+//	series:
+//	  - { id: MIN, title: 1m/1s, period: 1s, max_count: 60 }
+//	  - { id: HOUR, title: 1h/1m, period: 1m, max_count: 60, rollup_from: MIN }
+//	filter:
+//	  includes: ["go:*", "runtime:*"]
+//	computed:
+//	  - { name: "go:heap_percent", expr: "go:mem:heap_inuse / go:mem:sys * 100", type: gauge, unit: Percent }
+//	storage:
+//	  dir: ./data
+//	inputs:
+//	  - { type: my-input, interval: 5s }
+//	outputs:
+//	  - { name: stdout, includes: ["go:*"] }
+//	  - { type: my-output, config: { url: "http://localhost:8080" } }
+//	dashboard:
+//	  page_title: My Metrics
+//	  charts:
+//	    - { title: Goroutines, metric_names: ["go:goroutines"] }
+//
+// The types of the inputs and the outputs, e.g. my-input and my-output, are the names
+// registered by RegisterInput and RegisterOutput, and the output of a name without type,
+// e.g. stdout, is one of the outputs provided to Config.NewCollector.
+// Durations are strings that time.ParseDuration accepts.
+type Config struct {
+	SamplingInterval   string           `json:"sampling_interval,omitempty" yaml:"sampling_interval,omitempty"`
+	InputTimeout       string           `json:"input_timeout,omitempty" yaml:"input_timeout,omitempty"`
+	InputBuffer        int              `json:"input_buffer,omitempty" yaml:"input_buffer,omitempty"`
+	Prefix             string           `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+	Overflow           string           `json:"overflow,omitempty" yaml:"overflow,omitempty"` // block, drop-newest, drop-oldest or sample
+	OverflowSampleRate int              `json:"overflow_sample_rate,omitempty" yaml:"overflow_sample_rate,omitempty"`
+	MetricTTL          string           `json:"metric_ttl,omitempty" yaml:"metric_ttl,omitempty"`
+	MaxMetrics         int              `json:"max_metrics,omitempty" yaml:"max_metrics,omitempty"`
+	CardinalityPolicy  string           `json:"cardinality_policy,omitempty" yaml:"cardinality_policy,omitempty"` // drop-new or evict-idle
+	AbsenceIntervals   int              `json:"absence_intervals,omitempty" yaml:"absence_intervals,omitempty"`   // absence events are logged
+	AbsenceMetric      string           `json:"absence_metric,omitempty" yaml:"absence_metric,omitempty"`
+	Series             []SeriesConfig   `json:"series,omitempty" yaml:"series,omitempty"`
+	Filter             *FilterConfig    `json:"filter,omitempty" yaml:"filter,omitempty"`
+	Computed           []ComputedConfig `json:"computed,omitempty" yaml:"computed,omitempty"`
+	Storage            *StorageConfig   `json:"storage,omitempty" yaml:"storage,omitempty"`
+	Inputs             []InputConfig    `json:"inputs,omitempty" yaml:"inputs,omitempty"`
+	Outputs            []OutputConfig   `json:"outputs,omitempty" yaml:"outputs,omitempty"`
+	Dashboard          *DashboardConfig `json:"dashboard,omitempty" yaml:"dashboard,omitempty"`
+}
+
+type SeriesConfig struct {
+	ID         string `json:"id" yaml:"id"`
+	Title      string `json:"title,omitempty" yaml:"title,omitempty"`
+	Period     string `json:"period" yaml:"period"`
+	MaxCount   int    `json:"max_count" yaml:"max_count"`
+	RollupFrom string `json:"rollup_from,omitempty" yaml:"rollup_from,omitempty"` // ID of a preceding series
+}
+
+// FilterConfig selects the measures by their names, see CompileIncludeAndExclude.
+type FilterConfig struct {
+	Includes []string `json:"includes,omitempty" yaml:"includes,omitempty"`
+	Excludes []string `json:"excludes,omitempty" yaml:"excludes,omitempty"`
+}
+
+// ComputedConfig defines a computed metric, see WithComputed and ParseExpr.
+type ComputedConfig struct {
+	Name string `json:"name" yaml:"name"`
+	Expr string `json:"expr" yaml:"expr"`
+	Type string `json:"type" yaml:"type"` // counter, gauge, meter, timer, odometer, histogram or sketch_histogram
+	Unit Unit   `json:"unit,omitempty" yaml:"unit,omitempty"`
+}
+
+type StorageConfig struct {
+	Dir        string `json:"dir" yaml:"dir"`
+	BufferSize int    `json:"buffer_size,omitempty" yaml:"buffer_size,omitempty"`
+}
+
+// InputConfig creates an input registered by RegisterInput.
+type InputConfig struct {
+	Type         string         `json:"type" yaml:"type"`                     // name of the registered input
+	Name         string         `json:"name,omitempty" yaml:"name,omitempty"` // default is the type
+	Interval     string         `json:"interval,omitempty" yaml:"interval,omitempty"`
+	Timeout      string         `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Jitter       string         `json:"jitter,omitempty" yaml:"jitter,omitempty"`
+	InitialDelay string         `json:"initial_delay,omitempty" yaml:"initial_delay,omitempty"`
+	Config       map[string]any `json:"config,omitempty" yaml:"config,omitempty"`
+}
+
+// OutputConfig creates an output registered by RegisterOutput if Type is set,
+// otherwise it refers to an output that is provided to Config.NewCollector by its name.
+type OutputConfig struct {
+	Type     string         `json:"type,omitempty" yaml:"type,omitempty"`
+	Name     string         `json:"name,omitempty" yaml:"name,omitempty"`
+	Config   map[string]any `json:"config,omitempty" yaml:"config,omitempty"`
+	Includes []string       `json:"includes,omitempty" yaml:"includes,omitempty"`
+	Excludes []string       `json:"excludes,omitempty" yaml:"excludes,omitempty"`
+}
+
+type DashboardConfig struct {
+	PageTitle     string        `json:"page_title,omitempty" yaml:"page_title,omitempty"`
+	Theme         string        `json:"theme,omitempty" yaml:"theme,omitempty"` // light or dark
+	PanelHeight   string        `json:"panel_height,omitempty" yaml:"panel_height,omitempty"`
+	PanelMinWidth string        `json:"panel_min_width,omitempty" yaml:"panel_min_width,omitempty"`
+	PanelMaxWidth string        `json:"panel_max_width,omitempty" yaml:"panel_max_width,omitempty"`
+	ShowRemains   bool          `json:"show_remains,omitempty" yaml:"show_remains,omitempty"`
+	Charts        []ChartConfig `json:"charts,omitempty" yaml:"charts,omitempty"`
+}
+
+type ChartConfig struct {
+	ID          string   `json:"id,omitempty" yaml:"id,omitempty"`
+	Title       string   `json:"title,omitempty" yaml:"title,omitempty"`
+	SubTitle    string   `json:"sub_title,omitempty" yaml:"sub_title,omitempty"`
+	Type        string   `json:"type,omitempty" yaml:"type,omitempty"`
+	MetricNames []string `json:"metric_names" yaml:"metric_names"`
+	FieldNames  []string `json:"field_names,omitempty" yaml:"field_names,omitempty"`
+	Labels      Labels   `json:"labels,omitempty" yaml:"labels,omitempty"`
+	ShowSymbol  bool     `json:"show_symbol,omitempty" yaml:"show_symbol,omitempty"`
+	ShowDerived bool     `json:"show_derived,omitempty" yaml:"show_derived,omitempty"`
+}
+
+// ConfigError is a validation error of the configuration,
+// Key is the path of the offending key, e.g. "series[1].period".
+type ConfigError struct {
+	Key string
+	Err error
+}
+
+func (ce *ConfigError) Error() string {
+	if ce.Key == "" {
+		return fmt.Sprintf("config: %v", ce.Err)
+	}
+	return fmt.Sprintf("config: %s: %v", ce.Key, ce.Err)
+}
+
+func (ce *ConfigError) Unwrap() error {
+	return ce.Err
+}
+
+var ErrUnknownConfigFormat = errors.New("unknown config format")
+
+// LoadConfig reads the configuration file, the format is determined by
+// the extension of the file, .yaml, .yml or .json.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfig(data, strings.TrimPrefix(filepath.Ext(path), "."))
+}
+
+// ParseConfig parses the configuration in the format, "yaml", "yml" or "json",
+// and validates it. Unknown keys are rejected.
+func ParseConfig(data []byte, format string) (*Config, error) {
+	cfg := &Config{}
+	switch strings.ToLower(format) {
+	case "yaml", "yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, &ConfigError{Err: err}
+		}
+	case "json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(cfg); err != nil {
+			return nil, &ConfigError{Err: err}
+		}
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownConfigFormat, format)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate checks the configuration and returns a *ConfigError of the first offending key.
+func (cfg *Config) Validate() error {
+	_, err := cfg.collectorOptions(nil)
+	return err
+}
+
+// NewCollector creates a collector from the configuration.
+// The inputs and outputs that have a type are created by the registered factories,
+// the other outputs of the configuration are looked up by name in outputs.
+// If the storage is configured, it is opened before the collector is created,
+// the caller should close it, which is Collector.Storage(), after the collector is stopped.
+// It is closed if an error is returned.
+func (cfg *Config) NewCollector(outputs map[string]Output) (_ *Collector, err error) {
+	opts, err := cfg.collectorOptions(outputs)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Storage != nil {
+		if err := os.MkdirAll(cfg.Storage.Dir, 0755); err != nil {
+			return nil, &ConfigError{Key: "storage.dir", Err: err}
+		}
+		fs := NewFileStorage(cfg.Storage.Dir, cfg.Storage.BufferSize)
+		if err := fs.Open(); err != nil {
+			return nil, &ConfigError{Key: "storage.dir", Err: err}
+		}
+		// the collector is stopped before, on the errors below
+		defer func() {
+			if err != nil {
+				fs.Close()
+			}
+		}()
+		opts = append(opts, WithStorage(fs))
+	}
+	c := NewCollector(opts...)
+	for i, oc := range cfg.Outputs {
+		key := fmt.Sprintf("outputs[%d]", i)
+		out := outputs[oc.Name]
+		if oc.Type != "" {
+			if out, err = NewOutputPlugin(oc.Type, oc.Config); err != nil {
+				c.Stop()
+				return nil, &ConfigError{Key: key, Err: err}
+			}
+		}
+		if len(oc.Includes) > 0 || len(oc.Excludes) > 0 {
+			// validated by collectorOptions
+			filter, _ := CompileIncludeAndExclude(oc.Includes, oc.Excludes, ':')
+			out = &FilterOutput{Filter: filter, Output: out}
+		}
+		if err := c.AddOutput(out); err != nil {
+			c.Stop()
+			return nil, &ConfigError{Key: key, Err: err}
+		}
+	}
+	for i, ic := range cfg.Inputs {
+		key := fmt.Sprintf("inputs[%d]", i)
+		in, err := NewInputPlugin(ic.Type, ic.Config)
+		if err != nil {
+			c.Stop()
+			return nil, &ConfigError{Key: key, Err: err}
+		}
+		// validated by collectorOptions
+		inOpts, _ := ic.options(key)
+		if err := c.AddInputWithOptions(in, inOpts...); err != nil {
+			c.Stop()
+			return nil, &ConfigError{Key: key, Err: err}
+		}
+	}
+	return c, nil
+}
+
+// collectorOptions validates the configuration and converts it into the collector options.
+// If outputs is nil, the outputs are not looked up.
+func (cfg *Config) collectorOptions(outputs map[string]Output) ([]CollectorOption, error) {
+	var opts []CollectorOption
+	if d, err := parseConfigDuration("sampling_interval", cfg.SamplingInterval); err != nil {
+		return nil, err
+	} else if d > 0 {
+		opts = append(opts, WithSamplingInterval(d))
+	}
+	if d, err := parseConfigDuration("input_timeout", cfg.InputTimeout); err != nil {
+		return nil, err
+	} else if d > 0 {
+		opts = append(opts, WithInputTimeout(d))
+	}
+	if cfg.InputBuffer < 0 {
+		return nil, &ConfigError{Key: "input_buffer", Err: errors.New("must not be negative")}
+	} else if cfg.InputBuffer > 0 {
+		opts = append(opts, WithInputBuffer(cfg.InputBuffer))
+	}
+	if cfg.Prefix != "" {
+		opts = append(opts, WithPrefix(cfg.Prefix))
+	}
+	if cfg.Overflow != "" {
+		policy, err := parseOverflowPolicy(cfg.Overflow)
+		if err != nil {
+			return nil, &ConfigError{Key: "overflow", Err: err}
+		}
+		opts = append(opts, WithOverflowPolicy(policy))
+	}
+	if cfg.OverflowSampleRate > 0 {
+		opts = append(opts, WithOverflowSampleRate(cfg.OverflowSampleRate))
+	}
+	if d, err := parseConfigDuration("metric_ttl", cfg.MetricTTL); err != nil {
+		return nil, err
+	} else if d > 0 {
+		opts = append(opts, WithMetricTTL(d))
+	}
+	if cfg.MaxMetrics > 0 {
+		var policy CardinalityPolicy
+		switch cfg.CardinalityPolicy {
+		case "", "drop-new":
+			policy = CardinalityDropNew
+		case "evict-idle":
+			policy = CardinalityEvictIdle
+		default:
+			return nil, &ConfigError{Key: "cardinality_policy", Err: fmt.Errorf("unknown policy %q", cfg.CardinalityPolicy)}
+		}
+		opts = append(opts, WithMaxMetrics(cfg.MaxMetrics, policy))
+	}
+	if cfg.AbsenceIntervals < 0 {
+		return nil, &ConfigError{Key: "absence_intervals", Err: errors.New("must not be negative")}
+	} else if cfg.AbsenceIntervals > 0 {
+		opts = append(opts, WithAbsence(cfg.AbsenceIntervals, LogAbsence))
+		if cfg.AbsenceMetric != "" {
+			opts = append(opts, WithAbsenceMetric(cfg.AbsenceMetric))
+		}
+	}
+
+	seriesByID := map[string]SeriesID{}
+	for i, sc := range cfg.Series {
+		key := fmt.Sprintf("series[%d]", i)
+		period, err := parseConfigDuration(key+".period", sc.Period)
+		if err != nil {
+			return nil, err
+		} else if period <= 0 {
+			return nil, &ConfigError{Key: key + ".period", Err: errors.New("is required")}
+		}
+		if sc.MaxCount <= 0 {
+			return nil, &ConfigError{Key: key + ".max_count", Err: errors.New("must be positive")}
+		}
+		title := sc.Title
+		if title == "" {
+			title = sc.ID
+		}
+		ser, err := NewSeriesID(sc.ID, title, period, sc.MaxCount)
+		if err != nil {
+			return nil, &ConfigError{Key: key + ".id", Err: err}
+		}
+		if _, exists := seriesByID[ser.ID()]; exists {
+			return nil, &ConfigError{Key: key + ".id", Err: fmt.Errorf("duplicate series %q", ser.ID())}
+		}
+		if sc.RollupFrom != "" {
+			src, ok := seriesByID[strings.ToUpper(sc.RollupFrom)]
+			if !ok {
+				return nil, &ConfigError{Key: key + ".rollup_from", Err: fmt.Errorf("no preceding series %q", sc.RollupFrom)}
+			}
+			if err := checkRollup(src, ser); err != nil {
+				return nil, &ConfigError{Key: key + ".period", Err: err}
+			}
+			opts = append(opts, WithRollupChain(src, ser))
+		} else {
+			opts = append(opts, WithSeries(ser))
+		}
+		seriesByID[ser.ID()] = ser
+	}
+
+	if cfg.Filter != nil {
+		filter, err := CompileIncludeAndExclude(cfg.Filter.Includes, cfg.Filter.Excludes, ':')
+		if err != nil {
+			return nil, &ConfigError{Key: "filter", Err: err}
+		}
+		opts = append(opts, WithTimeseriesFilter(filter))
+	}
+	for i, cc := range cfg.Computed {
+		key := fmt.Sprintf("computed[%d]", i)
+		if cc.Name == "" {
+			return nil, &ConfigError{Key: key + ".name", Err: errors.New("is required")}
+		}
+		expr, err := ParseExpr(cc.Expr)
+		if err != nil {
+			return nil, &ConfigError{Key: key + ".expr", Err: err}
+		}
+		if cc.Type == "unique" || cc.Type == "bucket_histogram" {
+			// a computed value is neither a key to count nor fits the default buckets
+			return nil, &ConfigError{Key: key + ".type", Err: fmt.Errorf("type %q is not for computed metrics", cc.Type)}
+		}
+		typ, err := parseConfigType(cc.Type, cc.Unit)
+		if err != nil {
+			return nil, &ConfigError{Key: key + ".type", Err: err}
+		}
+		opts = append(opts, WithComputed(cc.Name, expr, typ))
+	}
+	if cfg.Storage != nil && cfg.Storage.Dir == "" {
+		return nil, &ConfigError{Key: "storage.dir", Err: errors.New("is required")}
+	}
+	for i, ic := range cfg.Inputs {
+		key := fmt.Sprintf("inputs[%d]", i)
+		if ic.Type == "" {
+			return nil, &ConfigError{Key: key + ".type", Err: errors.New("is required")}
+		}
+		if _, err := lookupPlugin(PluginInput, ic.Type); err != nil {
+			return nil, &ConfigError{Key: key + ".type", Err: err}
+		}
+		if _, err := ic.options(key); err != nil {
+			return nil, err
+		}
+	}
+	for i, oc := range cfg.Outputs {
+		key := fmt.Sprintf("outputs[%d]", i)
+		if oc.Type != "" {
+			if _, err := lookupPlugin(PluginOutput, oc.Type); err != nil {
+				return nil, &ConfigError{Key: key + ".type", Err: err}
+			}
+		} else if oc.Name == "" {
+			return nil, &ConfigError{Key: key + ".name", Err: errors.New("is required")}
+		} else if outputs != nil && outputs[oc.Name] == nil {
+			return nil, &ConfigError{Key: key + ".name", Err: fmt.Errorf("%w: %q", ErrOutputNotFound, oc.Name)}
+		}
+		if len(oc.Includes) > 0 || len(oc.Excludes) > 0 {
+			if _, err := CompileIncludeAndExclude(oc.Includes, oc.Excludes, ':'); err != nil {
+				return nil, &ConfigError{Key: key, Err: err}
+			}
+		}
+	}
+	if cfg.Dashboard != nil {
+		if _, err := cfg.Dashboard.charts(); err != nil {
+			return nil, err
+		}
+	}
+	return opts, nil
+}
+
+func (ic InputConfig) options(key string) ([]InputOption, error) {
+	name := ic.Name
+	if name == "" {
+		name = ic.Type
+	}
+	opts := []InputOption{InputName(name)}
+	for _, d := range []struct {
+		key string
+		val string
+		opt func(time.Duration) InputOption
+	}{
+		{"interval", ic.Interval, InputInterval},
+		{"timeout", ic.Timeout, InputTimeout},
+		{"jitter", ic.Jitter, InputJitter},
+		{"initial_delay", ic.InitialDelay, InputInitialDelay},
+	} {
+		v, err := parseConfigDuration(key+"."+d.key, d.val)
+		if err != nil {
+			return nil, err
+		}
+		if v > 0 {
+			opts = append(opts, d.opt(v))
+		}
+	}
+	return opts, nil
+}
+
+// NewDashboard creates a dashboard of the collector from the configuration.
+// If the dashboard is not configured, it returns a dashboard with the defaults.
+func (cfg *Config) NewDashboard(c *Collector) (*Dashboard, error) {
+	d := NewDashboard(c)
+	dc := cfg.Dashboard
+	if dc == nil {
+		return d, nil
+	}
+	if dc.PageTitle != "" {
+		d.PageTitle = dc.PageTitle
+	}
+	if dc.Theme != "" {
+		d.SetTheme(dc.Theme)
+	}
+	if dc.PanelHeight != "" {
+		d.SetPanelHeight(dc.PanelHeight)
+	}
+	if dc.PanelMinWidth != "" {
+		d.SetPanelMinWidth(dc.PanelMinWidth)
+	}
+	if dc.PanelMaxWidth != "" {
+		d.SetPanelMaxWidth(dc.PanelMaxWidth)
+	}
+	d.ShowRemains = dc.ShowRemains
+	charts, err := dc.charts()
+	if err != nil {
+		return nil, err
+	}
+	for i, chart := range charts {
+		if err := d.AddChart(chart); err != nil {
+			return nil, &ConfigError{Key: fmt.Sprintf("dashboard.charts[%d]", i), Err: err}
+		}
+	}
+	return d, nil
+}
+
+func (dc *DashboardConfig) charts() ([]Chart, error) {
+	switch dc.Theme {
+	case "", "light", "dark":
+	default:
+		return nil, &ConfigError{Key: "dashboard.theme", Err: fmt.Errorf("unknown theme %q", dc.Theme)}
+	}
+	ret := make([]Chart, len(dc.Charts))
+	for i, cc := range dc.Charts {
+		key := fmt.Sprintf("dashboard.charts[%d]", i)
+		if len(cc.MetricNames) == 0 {
+			return nil, &ConfigError{Key: key + ".metric_names", Err: errors.New("is required")}
+		}
+		switch ChartType(cc.Type) {
+		case "", ChartTypeLine, ChartTypeLineStack, ChartTypeBar, ChartTypeBarStack, ChartTypeScatter, ChartTypeCandlestick:
+		default:
+			return nil, &ConfigError{Key: key + ".type", Err: fmt.Errorf("unknown chart type %q", cc.Type)}
+		}
+		if _, err := Compile(cc.MetricNames, ':'); err != nil {
+			return nil, &ConfigError{Key: key + ".metric_names", Err: err}
+		}
+		if _, err := Compile(cc.FieldNames); err != nil {
+			return nil, &ConfigError{Key: key + ".field_names", Err: err}
+		}
+		ret[i] = Chart{
+			ID:          cc.ID,
+			Title:       cc.Title,
+			SubTitle:    cc.SubTitle,
+			Type:        ChartType(cc.Type),
+			MetricNames: cc.MetricNames,
+			FieldNames:  cc.FieldNames,
+			Labels:      cc.Labels,
+			ShowSymbol:  cc.ShowSymbol,
+			ShowDerived: cc.ShowDerived,
+		}
+	}
+	return ret, nil
+}
+
+func parseConfigDuration(key string, s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, &ConfigError{Key: key, Err: err}
+	}
+	if d < 0 {
+		return 0, &ConfigError{Key: key, Err: errors.New("must not be negative")}
+	}
+	return d, nil
+}
+
+func parseConfigType(name string, unit Unit) (Type, error) {
+	switch name {
+	case "counter":
+		return CounterType(unit), nil
+	case "gauge":
+		return GaugeType(unit), nil
+	case "meter":
+		return MeterType(unit), nil
+	case "timer":
+		return TimerType(), nil
+	case "odometer":
+		return OdometerType(unit), nil
+	case "histogram":
+		return HistogramType(unit), nil
+	case "sketch_histogram":
+		return SketchHistogramType(unit, 0.01), nil
+	case "bucket_histogram":
+		return BucketHistogramType(unit), nil
+	case "unique":
+		return UniqueType(unit), nil
+	default:
+		return Type{}, fmt.Errorf("unknown type %q", name)
+	}
+}
+
+func parseOverflowPolicy(s string) (OverflowPolicy, error) {
+	for _, p := range []OverflowPolicy{OverflowBlock, OverflowDropNewest, OverflowDropOldest, OverflowSample} {
+		if p.String() == s {
+			return p, nil
+		}
+	}
+	return OverflowBlock, fmt.Errorf("unknown policy %q", s)
+}
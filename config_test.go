@@ -0,0 +1,181 @@
+package metric
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testConfigYAML = `
+sampling_interval: 1s
+prefix: cfg
+overflow: drop-oldest
+series:
+  - { id: MIN, title: 1m/1s, period: 1s, max_count: 60 }
+  - { id: HOUR, title: 1h/1m, period: 1m, max_count: 60, rollup_from: min }
+filter:
+  includes: ["go:*"]
+outputs:
+  - { name: capture, includes: ["go:goroutines"] }
+dashboard:
+  page_title: Test Metrics
+  theme: light
+  charts:
+    - { id: goroutines, title: Goroutines, metric_names: ["go:goroutines"] }
+    - { title: Memory, metric_names: ["go:mem:*"], type: line-stack }
+`
+
+func TestConfigYAML(t *testing.T) {
+	cfg, err := ParseConfig([]byte(testConfigYAML), "yaml")
+	require.NoError(t, err)
+
+	var captured []Product
+	c, err := cfg.NewCollector(map[string]Output{
+		"capture": &OutputFuncWrapper{func(p Product) error {
+			captured = append(captured, p)
+			return nil
+		}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, time.Second, c.SamplingInterval())
+	series := c.Series()
+	require.Len(t, series, 2)
+	require.Equal(t, "MIN", series[0].ID())
+	require.Equal(t, "HOUR", series[1].ID())
+	require.Equal(t, map[string]string{"HOUR": "MIN"}, c.rollups)
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 3 {
+		c.receive(&Gather{ts: now.Add(time.Duration(i) * time.Second), measures: []Measure{
+			{Name: "go:goroutines", Value: 10, Type: GaugeType(UnitShort)},
+			{Name: "go:mem:heap", Value: 10, Type: GaugeType(UnitBytes)},
+			{Name: "app:requests", Value: 1, Type: CounterType(UnitShort)},
+		}})
+	}
+	require.ElementsMatch(t, []string{"go:goroutines", "go:mem:heap"}, c.MetricNames())
+	require.Len(t, captured, 2)
+	for _, p := range captured {
+		require.Equal(t, "go:goroutines", p.Name)
+	}
+
+	d, err := cfg.NewDashboard(c)
+	require.NoError(t, err)
+	require.Equal(t, "Test Metrics", d.PageTitle)
+	require.Equal(t, "light", d.Option.Theme)
+	require.Len(t, d.Charts, 2)
+	require.Equal(t, "goroutines", d.Charts[0].ID)
+	require.Equal(t, ChartTypeLineStack, d.Charts[1].Type)
+	c.Stop()
+}
+
+func TestConfigJSONFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "metric.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"sampling_interval": "5s",
+		"series": [{"id": "MIN", "period": "1s", "max_count": 60}],
+		"storage": {"dir": "`+filepath.ToSlash(filepath.Join(dir, "data"))+`"}
+	}`), 0644))
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+	c, err := cfg.NewCollector(nil)
+	require.NoError(t, err)
+	require.Equal(t, 5*time.Second, c.SamplingInterval())
+	require.NotNil(t, c.Storage())
+	require.DirExists(t, filepath.Join(dir, "data"))
+	c.Stop()
+	c.Storage().(*FileStorage).Close()
+}
+
+func TestConfigStorageOnError(t *testing.T) {
+	dir := t.TempDir()
+	for _, section := range []string{
+		"outputs:\n  - { type: test-capture, config: { capacity: abc } }",
+		"inputs:\n  - { type: test-static, config: { value: abc } }",
+	} {
+		before := runtime.NumGoroutine()
+		cfg, err := ParseConfig([]byte("storage:\n  dir: "+filepath.ToSlash(dir)+"\n"+section), "yaml")
+		require.NoError(t, err)
+		_, err = cfg.NewCollector(nil)
+		var ce *ConfigError
+		require.ErrorAs(t, err, &ce)
+		// the write loop of the storage is not left running
+		for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		require.LessOrEqual(t, runtime.NumGoroutine(), before, section)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	tests := []struct {
+		format string
+		conf   string
+		key    string
+		errMsg string
+	}{
+		{"yaml", "sampling_interval: 1x", "sampling_interval", ""},
+		{"yaml", "series:\n  - { id: MIN, period: 1s, max_count: 60 }\n  - { id: HOUR, period: soon, max_count: 60 }", "series[1].period", ""},
+		{"yaml", "series:\n  - { id: HOUR, period: 1m, max_count: 60, rollup_from: MIN }", "series[0].rollup_from", ""},
+		{"yaml", "series:\n  - { id: MIN, period: 2s, max_count: 60 }\n  - { id: HOUR, period: 3s, max_count: 60, rollup_from: MIN }", "series[1].period", ""},
+		{"yaml", "series:\n  - { id: MIN, period: 1s, max_count: 0 }", "series[0].max_count", ""},
+		{"yaml", "overflow: never", "overflow", ""},
+		{"yaml", "absence_intervals: -1", "absence_intervals", ""},
+		{"yaml", "outputs:\n  - { includes: [a] }", "outputs[0].name", ""},
+		{"yaml", "dashboard:\n  charts:\n    - { title: t }", "dashboard.charts[0].metric_names", ""},
+		{"yaml", "dashboard:\n  charts:\n    - { metric_names: [a], type: pie }", "dashboard.charts[0].type", ""},
+		{"yaml", "sampling_intervall: 1s", "", "sampling_intervall"},
+		{"json", `{"seriess": []}`, "", "seriess"},
+	}
+	for _, tt := range tests {
+		_, err := ParseConfig([]byte(tt.conf), tt.format)
+		require.Error(t, err, tt.conf)
+		var ce *ConfigError
+		require.ErrorAs(t, err, &ce, tt.conf)
+		require.Equal(t, tt.key, ce.Key, tt.conf)
+		if tt.errMsg != "" {
+			require.Contains(t, err.Error(), tt.errMsg)
+		}
+	}
+
+	cfg, err := ParseConfig([]byte("outputs:\n  - { name: missing }"), "yaml")
+	require.NoError(t, err)
+	_, err = cfg.NewCollector(map[string]Output{})
+	require.ErrorIs(t, err, ErrOutputNotFound)
+
+	_, err = ParseConfig([]byte("{}"), "toml")
+	require.ErrorIs(t, err, ErrUnknownConfigFormat)
+}
+
+func TestConfigComputed(t *testing.T) {
+	cfg, err := ParseConfig([]byte(`
+series:
+  - { id: MIN, period: 1s, max_count: 60 }
+computed:
+  - { name: "cpu:avg", expr: "avg(cpu:*)", type: gauge, unit: Percent }
+`), "yaml")
+	require.NoError(t, err)
+	c, err := cfg.NewCollector(nil)
+	require.NoError(t, err)
+	require.Len(t, c.computed, 1)
+	require.Equal(t, "avg(cpu:*)", c.computed[0].expr.String())
+	require.Equal(t, UnitPercent, c.computed[0].typ.Unit())
+	c.Stop()
+
+	for conf, key := range map[string]string{
+		`computed: [{ name: a, expr: "cpu:*", type: gauge }]`:            "computed[0].expr",
+		`computed: [{ name: a, expr: "cpu:0", type: summary }]`:          "computed[0].type",
+		`computed: [{ name: a, expr: "cpu:0", type: unique }]`:           "computed[0].type",
+		`computed: [{ name: a, expr: "cpu:0", type: bucket_histogram }]`: "computed[0].type",
+		`computed: [{ expr: "cpu:0", type: gauge }]`:                     "computed[0].name",
+	} {
+		_, err := ParseConfig([]byte(conf), "yaml")
+		var ce *ConfigError
+		require.ErrorAs(t, err, &ce, conf)
+		require.Equal(t, key, ce.Key, conf)
+	}
+}
@@ -2,6 +2,7 @@ package metric
 
 import (
 	"encoding/json"
+	"fmt"
 	"sync"
 )
 
@@ -56,6 +57,18 @@ func (fs *Counter) Add(v float64) {
 	fs.samples++
 }
 
+func (fs *Counter) Merge(v Value) error {
+	cv, ok := v.(*CounterValue)
+	if !ok {
+		return fmt.Errorf("%w: %T into counter", ErrNotMergeable, v)
+	}
+	fs.Lock()
+	defer fs.Unlock()
+	fs.value += cv.Value
+	fs.samples += cv.Samples
+	return nil
+}
+
 func (fs *Counter) Produce(reset bool) Value {
 	fs.Lock()
 	defer fs.Unlock()
@@ -78,7 +91,7 @@ type CounterValue struct {
 	Samples int64   `json:"samples"`
 	Value   float64 `json:"value"`
 	// Optional derived values, such as moving averages
-	DerivedValues map[string]Value `json:"derived,omitempty"`
+	DerivedValues DerivedValues `json:"derived,omitempty"`
 }
 
 func (cp *CounterValue) String() string {
@@ -88,7 +101,7 @@ func (cp *CounterValue) String() string {
 
 func (cp *CounterValue) SetDerivedValue(name string, value Value) {
 	if cp.DerivedValues == nil {
-		cp.DerivedValues = make(map[string]Value)
+		cp.DerivedValues = make(DerivedValues)
 	}
 	cp.DerivedValues[name] = value
 }
@@ -20,6 +20,7 @@ func NewDashboard(c *Collector) *Dashboard {
 		SamplingInterval:   c.SamplingInterval(),
 		nameProvider:       c.MetricNames,
 		timeseriesProvider: c.Timeseries,
+		selectProvider:     c.Select,
 		PageTitle:          "Metrics",
 	}
 	return d
@@ -37,16 +38,19 @@ type Dashboard struct {
 	PageTitle          string
 	nameProvider       func() []string
 	timeseriesProvider func(string) MultiTimeSeries
+	selectProvider     func(string, Labels) []string
 }
 
 type Chart struct {
 	MetricNames []string // metric names or patterns to include in this chart
 	FieldNames  []string // optional, field names of the metric to show in this chart
+	Labels      Labels   // optional, only the series that have these labels are shown
 	ID          string
 	Title       string
 	SubTitle    string
 	Type        ChartType // e.g., line, bar
 	ShowSymbol  bool      // whether to show symbol on the line chart
+	ShowDerived bool      // whether to show the derived values, e.g. moving averages, as extra series
 
 	metricNameFilter Filter
 	fieldNameFilter  Filter
@@ -91,8 +95,7 @@ func (d *Dashboard) AddChart(co ...Chart) error {
 }
 
 func (d Dashboard) Panels() []Chart {
-	lst := d.nameProvider()
-	slices.Sort(lst)
+	lst := d.measureNames()
 
 	ret := []Chart{}
 	for idx := range d.Charts {
@@ -122,12 +125,37 @@ func (d Dashboard) Panels() []Chart {
 	return ret
 }
 
+// measureNames returns the sorted measure names of all series,
+// the labeled series of a measure are represented by the measure name.
+func (d Dashboard) measureNames() []string {
+	lst := d.nameProvider()
+	for i, key := range lst {
+		lst[i] = splitSeriesKey(key)
+	}
+	slices.Sort(lst)
+	return slices.Compact(lst)
+}
+
+// seriesKeys returns the keys of the series that the metric name of the chart refers to.
+// A measure name fans out into all of its labeled series that match the labels of the chart,
+// and it refers to the unlabeled series only if the chart has no labels.
+func (d Dashboard) seriesKeys(metricName string, labels Labels) []string {
+	if d.selectProvider != nil {
+		if keys := d.selectProvider(metricName, labels); len(keys) > 0 {
+			return keys
+		}
+	}
+	if len(labels) > 0 {
+		return nil
+	}
+	return []string{metricName}
+}
+
 func (d Dashboard) refreshPanel(po *Chart) {
 	if po.metricNameFilter == nil {
 		return
 	}
-	lst := d.nameProvider()
-	slices.Sort(lst)
+	lst := d.measureNames()
 	for _, name := range lst {
 		if po.metricNameFilter.Match(name) {
 			if !slices.Contains(po.MetricNames, name) {
@@ -358,22 +386,24 @@ func (d Dashboard) HandleData(w http.ResponseWriter, r *http.Request) {
 	var notFound bool = true
 	var notFoundNames []string
 	for _, metricName := range panelOpt.MetricNames {
-		ss, ssExists := d.getSnapshot(metricName, tsIdx)
+		for _, key := range d.seriesKeys(metricName, panelOpt.Labels) {
+			ss, ssExists := d.getSnapshot(key, tsIdx)
 
-		if !ssExists {
-			notFoundNames = append(notFoundNames, metricName)
-			continue
-		}
-		notFound = false
-		series = append(series, ss.Series(panelOpt)...)
+			if !ssExists {
+				notFoundNames = append(notFoundNames, key)
+				continue
+			}
+			notFound = false
+			series = append(series, ss.Series(panelOpt)...)
 
-		if meta == nil {
-			meta = &ss.Meta
-			seriesInterval = ss.Interval
-			seriesMaxCount = ss.MaxCount
-		}
-		if panelOpt.Title == "" {
-			panelOpt.Title = ss.PublishName
+			if meta == nil {
+				meta = &ss.Meta
+				seriesInterval = ss.Interval
+				seriesMaxCount = ss.MaxCount
+			}
+			if panelOpt.Title == "" {
+				panelOpt.Title = ss.PublishName
+			}
 		}
 	}
 	var seriesSingleOrArray any
@@ -448,6 +478,7 @@ type Series struct {
 	Smooth     bool           `json:"smooth"`              //  true,
 	ShowSymbol bool           `json:"showSymbol"`          // showSymbol: true,
 	AreaStyle  map[string]any `json:"areaStyle,omitempty"` // {}
+	LineStyle  map[string]any `json:"lineStyle,omitempty"` // {"type": "dashed"}
 }
 
 // trimSeriesNames trims the series names to remove common prefixes and suffixes of all series' names
@@ -553,22 +584,31 @@ func (ct ChartType) TypeAndStack(fallback string) (string, any) {
 }
 
 func (ss Snapshot) Series(opt Chart) []Series {
+	var series []Series
 	switch ss.Meta.MeasureType.Name() {
 	case "counter":
-		return ss.counterToSeries(opt)
+		series = ss.counterToSeries(opt)
 	case "gauge":
-		return ss.gaugeToSeries(opt)
+		series = ss.gaugeToSeries(opt)
 	case "meter":
-		return ss.meterToSeries(opt)
+		series = ss.meterToSeries(opt)
 	case "timer":
-		return ss.timerToSeries(opt)
+		series = ss.timerToSeries(opt)
 	case "odometer":
-		return ss.odometerToSeries(opt)
+		series = ss.odometerToSeries(opt)
 	case "histogram":
-		return ss.histogramToSeries(opt)
+		series = ss.histogramToSeries(opt)
+	case "bucket_histogram":
+		series = ss.bucketHistogramToSeries(opt)
+	case "unique":
+		series = ss.uniqueToSeries(opt)
 	default:
 		return []Series{}
 	}
+	if opt.ShowDerived {
+		series = append(series, ss.derivedToSeries(opt)...)
+	}
+	return series
 }
 
 func (ss Snapshot) counterToSeries(opt Chart) []Series {
@@ -582,7 +622,28 @@ func (ss Snapshot) counterToSeries(opt Chart) []Series {
 		}
 	}
 	series = append(series, Series{
-		Name:       ss.Meta.MeasureName,
+		Name:       ss.Meta.Key(),
+		Type:       typ,
+		Data:       data,
+		Stack:      stack,
+		Smooth:     true,
+		ShowSymbol: opt.ShowSymbol,
+	})
+	return series
+}
+
+func (ss Snapshot) uniqueToSeries(opt Chart) []Series {
+	var series []Series
+	typ, stack := opt.Type.TypeAndStack("line")
+	data := make([]Item, len(ss.Times))
+	for i, t := range ss.Times {
+		data[i].Time = t.UnixMilli()
+		if v, ok := ss.Values[i].(*UniqueValue); ok && v.Samples > 0 {
+			data[i].Value = v.Value
+		}
+	}
+	series = append(series, Series{
+		Name:       ss.Meta.Key(),
 		Type:       typ,
 		Data:       data,
 		Stack:      stack,
@@ -614,7 +675,7 @@ func (ss Snapshot) gaugeToSeries(opt Chart) []Series {
 			}
 		}
 		series = append(series, Series{
-			Name:       ss.Meta.MeasureName + "#" + fieldName,
+			Name:       ss.Meta.Key() + "#" + fieldName,
 			Type:       typ,
 			Data:       data,
 			Stack:      stack,
@@ -660,7 +721,7 @@ func (ss Snapshot) meterToSeries(opt Chart) []Series {
 			}
 		}
 		series = append(series, Series{
-			Name:       ss.Meta.MeasureName + "#" + fieldName,
+			Name:       ss.Meta.Key() + "#" + fieldName,
 			Type:       typ,
 			Data:       data,
 			Stack:      stack,
@@ -696,7 +757,7 @@ func (ss Snapshot) timerToSeries(opt Chart) []Series {
 			}
 		}
 		series = append(series, Series{
-			Name:       ss.Meta.MeasureName + "#" + fieldName,
+			Name:       ss.Meta.Key() + "#" + fieldName,
 			Type:       typ,
 			Data:       data,
 			Stack:      stack,
@@ -710,7 +771,7 @@ func (ss Snapshot) timerToSeries(opt Chart) []Series {
 func (ss Snapshot) odometerToSeries(opt Chart) []Series {
 	var series []Series
 	typ, stack := opt.Type.TypeAndStack("bar")
-	allFieldNames := []string{"first", "last", "diff", "non_negative_diff", "abs_diff"}
+	allFieldNames := []string{"first", "last", "diff", "non_negative_diff", "abs_diff", "increase"}
 	if opt.fieldNameFilter == nil {
 		// if no field filter, always shows the "diff" field only
 		allFieldNames = []string{"last"}
@@ -737,10 +798,12 @@ func (ss Snapshot) odometerToSeries(opt Chart) []Series {
 				data[i].Value = v.NonNegativeDiff()
 			case "abs_diff":
 				data[i].Value = v.AbsDiff()
+			case "increase":
+				data[i].Value = v.Increase()
 			}
 		}
 		series = append(series, Series{
-			Name:       ss.Meta.MeasureName + "#" + fieldName,
+			Name:       ss.Meta.Key() + "#" + fieldName,
 			Type:       typ,
 			Stack:      stack,
 			Data:       data,
@@ -761,11 +824,7 @@ func (ss Snapshot) histogramToSeries(opt Chart) []Series {
 		return series
 	}
 	for pIdx, p := range last.P {
-		pName := fmt.Sprintf("p%d", int(p*1000))
-		if pName[len(pName)-1] == '0' {
-			pName = pName[:len(pName)-1]
-		}
-		fieldNames[pName] = pIdx
+		fieldNames[percentileName(p)] = pIdx
 	}
 	for fieldName, pIdx := range fieldNames {
 		if opt.fieldNameFilter != nil && !opt.fieldNameFilter.Match(fieldName) {
@@ -781,7 +840,7 @@ func (ss Snapshot) histogramToSeries(opt Chart) []Series {
 			data[i].Value = v.Values[pIdx]
 		}
 		series = append(series, Series{
-			Name:       ss.Meta.MeasureName + "#" + fieldName,
+			Name:       ss.Meta.Key() + "#" + fieldName,
 			Type:       typ,
 			Stack:      stack,
 			Data:       data,
@@ -792,6 +851,166 @@ func (ss Snapshot) histogramToSeries(opt Chart) []Series {
 	return series
 }
 
+// bucketHistogramToSeries shows the count of each bucket, not the cumulative one,
+// as stacked bars by default, so that the bars draw the distribution over the time.
+func (ss Snapshot) bucketHistogramToSeries(opt Chart) []Series {
+	var series []Series
+	typ, stack := opt.Type.TypeAndStack("bar")
+	if opt.Type == "" {
+		stack = "total"
+	}
+	last, ok := ss.Values[len(ss.Values)-1].(*BucketHistogramValue)
+	if !ok {
+		return series
+	}
+	for bIdx, fieldName := range last.BucketNames() {
+		if opt.fieldNameFilter != nil && !opt.fieldNameFilter.Match(fieldName) {
+			continue
+		}
+		data := make([]Item, len(ss.Times))
+		for i, tm := range ss.Times {
+			data[i].Time = tm.UnixMilli()
+			v, ok := ss.Values[i].(*BucketHistogramValue)
+			if !ok || v.Samples == 0 || len(v.Counts) != len(last.Counts) {
+				continue
+			}
+			data[i].Value = v.Counts[bIdx]
+			if bIdx > 0 {
+				data[i].Value = v.Counts[bIdx] - v.Counts[bIdx-1]
+			}
+		}
+		series = append(series, Series{
+			Name:       ss.Meta.Key() + "#" + fieldName,
+			Type:       typ,
+			Stack:      stack,
+			Data:       data,
+			ShowSymbol: opt.ShowSymbol,
+		})
+	}
+	return series
+}
+
+// derivedToSeries shows the derived values as lines of the ID of the deriver
+// and the field, e.g. "ma5.avg" and "rate.value", see FieldValue.
+func (ss Snapshot) derivedToSeries(opt Chart) []Series {
+	var series []Series
+	if len(ss.Values) == 0 {
+		return series
+	}
+	last := derivedValues(ss.Values[len(ss.Values)-1])
+	ids := make([]string, 0, len(last))
+	for id := range last {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	for _, id := range ids {
+		if _, ok := last[id].(*AnomalyValue); ok {
+			if opt.fieldNameFilter == nil || opt.fieldNameFilter.Match(id+".anomaly") {
+				series = append(series, ss.anomalyToSeries(id))
+			}
+			continue
+		}
+		if fv, ok := last[id].(*ForecastValue); ok {
+			if opt.fieldNameFilter == nil || opt.fieldNameFilter.Match(id+".forecast") {
+				series = append(series, ss.forecastToSeries(id, fv, opt))
+			}
+			continue
+		}
+		for _, field := range defaultFieldNames(last[id]) {
+			fieldName := id + "." + field
+			if opt.fieldNameFilter != nil && !opt.fieldNameFilter.Match(fieldName) {
+				continue
+			}
+			data := make([]Item, len(ss.Times))
+			for i, tm := range ss.Times {
+				data[i].Time = tm.UnixMilli()
+				if v, ok := FieldValue(derivedValues(ss.Values[i])[id], field); ok {
+					data[i].Value = v
+				}
+			}
+			s := Series{
+				Name:       ss.Meta.Key() + "#" + fieldName,
+				Type:       "line",
+				Data:       data,
+				Smooth:     true,
+				ShowSymbol: opt.ShowSymbol,
+			}
+			if _, ok := last[id].(*BandValue); ok && field != "mean" {
+				// the bands are drawn dashed around the mean
+				s.LineStyle = map[string]any{"type": "dashed"}
+			}
+			series = append(series, s)
+		}
+	}
+	return series
+}
+
+// forecastToSeries shows the forecast of the current bin as a dashed continuation
+// from the fitted value of the last bin.
+func (ss Snapshot) forecastToSeries(id string, fv *ForecastValue, opt Chart) Series {
+	var data []Item
+	if fv.Bins > 0 && len(ss.Times) > 0 {
+		tm := ss.Times[len(ss.Times)-1]
+		data = append(data, Item{Time: tm.UnixMilli(), Value: fv.Fitted})
+		for k, v := range fv.Values {
+			data = append(data, Item{Time: tm.Add(time.Duration(k+1) * ss.Interval).UnixMilli(), Value: v})
+		}
+	}
+	return Series{
+		Name:       ss.Meta.Key() + "#" + id + ".forecast",
+		Type:       "line",
+		Data:       data,
+		ShowSymbol: opt.ShowSymbol,
+		LineStyle:  map[string]any{"type": "dashed"},
+	}
+}
+
+// anomalyToSeries marks the values of the anomalous bins.
+func (ss Snapshot) anomalyToSeries(id string) Series {
+	data := make([]Item, len(ss.Times))
+	for i, tm := range ss.Times {
+		data[i].Time = tm.UnixMilli()
+		if av, ok := derivedValues(ss.Values[i])[id].(*AnomalyValue); ok && av.Anomaly {
+			data[i].Value = av.Value
+		}
+	}
+	return Series{
+		Name:       ss.Meta.Key() + "#" + id + ".anomaly",
+		Type:       "scatter",
+		Data:       data,
+		ShowSymbol: true,
+	}
+}
+
+// defaultFieldNames returns the fields of a derived value to show in the dashboard.
+func defaultFieldNames(v Value) []string {
+	switch val := v.(type) {
+	case *CounterValue, *RateValue:
+		return []string{"value"}
+	case *GaugeValue:
+		return []string{"avg", "last"}
+	case *MeterValue:
+		return []string{"min", "max", "avg"}
+	case *TimerValue:
+		return []string{"min", "max", "avg"}
+	case *OdometerValue:
+		return []string{"last"}
+	case *HistogramValue:
+		ret := make([]string, len(val.P))
+		for i, p := range val.P {
+			ret[i] = percentileName(p)
+		}
+		return ret
+	case *BucketHistogramValue:
+		return []string{"avg"}
+	case *UniqueValue:
+		return []string{"value"}
+	case *BandValue:
+		return []string{"mean", "upper", "lower"}
+	}
+	return nil
+}
+
 //go:embed dashboard.tmpl
 var tmplIndexHtml string
 
@@ -2,6 +2,7 @@ package metric
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -36,3 +37,59 @@ func TestTrimSeriesNames(t *testing.T) {
 	require.Equal(t, "goroutines", series3[0].Name)
 	require.Equal(t, "threads", series3[1].Name)
 }
+
+func TestSnapshotDerivedSeries(t *testing.T) {
+	tm := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	ss := Snapshot{
+		Times: []time.Time{tm, tm.Add(time.Second)},
+		Values: []Value{
+			nil,
+			&CounterValue{Samples: 2, Value: 6, DerivedValues: DerivedValues{
+				"rate": &RateValue{Samples: 2, Value: 6},
+			}},
+		},
+		Meta: SeriesInfo{MeasureName: "requests", MeasureType: CounterType(UnitShort)},
+	}
+	require.Len(t, ss.Series(Chart{}), 1)
+	series := ss.Series(Chart{ShowDerived: true})
+	require.Len(t, series, 2)
+	require.Equal(t, "requests", series[0].Name)
+	require.Equal(t, "requests#rate.value", series[1].Name)
+	require.Equal(t, "line", series[1].Type)
+	require.Nil(t, series[1].Data[0].Value)
+	require.Equal(t, 6.0, series[1].Data[1].Value)
+}
+
+func TestSnapshotBandSeries(t *testing.T) {
+	tm := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	ss := Snapshot{
+		Times: []time.Time{tm},
+		Values: []Value{
+			&GaugeValue{Samples: 1, Sum: 6, Value: 6, DerivedValues: DerivedValues{
+				"band": &BandValue{Bins: 1, Mean: 5, Upper: 5, Lower: 5},
+			}},
+		},
+		Meta: SeriesInfo{MeasureName: "latency", MeasureType: GaugeType(UnitDuration)},
+	}
+	series := ss.derivedToSeries(Chart{})
+	require.Len(t, series, 3)
+	require.Equal(t, "latency#band.mean", series[0].Name)
+	require.Nil(t, series[0].LineStyle)
+	require.Equal(t, "latency#band.upper", series[1].Name)
+	require.Equal(t, map[string]any{"type": "dashed"}, series[1].LineStyle)
+	require.Equal(t, "latency#band.lower", series[2].Name)
+	require.Equal(t, map[string]any{"type": "dashed"}, series[2].LineStyle)
+}
+
+func TestDashboardSeriesKeys(t *testing.T) {
+	d := Dashboard{selectProvider: func(name string, labels Labels) []string {
+		if name == "disk:used_percent" && labels.Match(Labels{"host": "a"}) {
+			return []string{`disk:used_percent{host="a"}`}
+		}
+		return nil
+	}}
+	require.Equal(t, []string{`disk:used_percent{host="a"}`}, d.seriesKeys("disk:used_percent", Labels{"host": "a"}))
+	// a labeled chart does not show the unlabeled series
+	require.Empty(t, d.seriesKeys("disk:used_percent", Labels{"host": "b"}))
+	require.Equal(t, []string{"mem:used"}, d.seriesKeys("mem:used", nil))
+}
@@ -0,0 +1,404 @@
+package metric
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expr is an arithmetic expression over the values of metrics, e.g.
+//
+//	mem:used / mem:total * 100
+//	sum(cpu:*) / count(cpu:*)
+//	max(disk:used_percent, disk:inodes_percent)
+//
+// A metric name refers to the value of the series of the name without labels.
+// The aggregate functions sum, avg, min, max and count take names or patterns
+// that are compiled by Compile, and include the labeled series of the matched names.
+// Since '*' is a wildcard in a name, the operators should be separated from the names by spaces.
+type Expr struct {
+	src  string
+	root exprNode
+}
+
+// ParseExpr parses the expression.
+func ParseExpr(s string) (*Expr, error) {
+	p := &exprParser{src: s}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	root, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %q", p.tok.text)
+	}
+	return &Expr{src: s, root: root}, nil
+}
+
+// MustParseExpr is like ParseExpr but panics if the expression cannot be parsed.
+func MustParseExpr(s string) *Expr {
+	e, err := ParseExpr(s)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Eval evaluates the expression with the values of the series keyed by the series keys.
+// It returns NaN if a referenced metric has no value.
+func (e *Expr) Eval(values map[string]float64) float64 {
+	return e.root.eval(values, nil)
+}
+
+// evalComputed is like Eval, and the metric names can also refer to the computed values,
+// which are not included in the aggregate functions.
+// It returns NaN if none of the referred metrics has a value.
+func (e *Expr) evalComputed(values, computed map[string]float64) float64 {
+	if !e.root.hasValue(values, computed) {
+		return math.NaN()
+	}
+	return e.root.eval(values, computed)
+}
+
+type exprNode interface {
+	eval(values, computed map[string]float64) float64
+	// hasValue reports whether any of the referred metrics has a value
+	hasValue(values, computed map[string]float64) bool
+}
+
+type numNode float64
+
+func (n numNode) eval(_, _ map[string]float64) float64 {
+	return float64(n)
+}
+
+func (n numNode) hasValue(_, _ map[string]float64) bool {
+	return false
+}
+
+type refNode string
+
+func (n refNode) eval(values, computed map[string]float64) float64 {
+	if v, ok := values[string(n)]; ok {
+		return v
+	}
+	if v, ok := computed[string(n)]; ok {
+		return v
+	}
+	return math.NaN()
+}
+
+func (n refNode) hasValue(values, computed map[string]float64) bool {
+	if _, ok := values[string(n)]; ok {
+		return true
+	}
+	_, ok := computed[string(n)]
+	return ok
+}
+
+type negNode struct {
+	x exprNode
+}
+
+func (n negNode) eval(values, computed map[string]float64) float64 {
+	return -n.x.eval(values, computed)
+}
+
+func (n negNode) hasValue(values, computed map[string]float64) bool {
+	return n.x.hasValue(values, computed)
+}
+
+type binNode struct {
+	op   byte
+	l, r exprNode
+}
+
+func (n binNode) eval(values, computed map[string]float64) float64 {
+	l, r := n.l.eval(values, computed), n.r.eval(values, computed)
+	switch n.op {
+	case '+':
+		return l + r
+	case '-':
+		return l - r
+	case '*':
+		return l * r
+	default:
+		return l / r
+	}
+}
+
+func (n binNode) hasValue(values, computed map[string]float64) bool {
+	return n.l.hasValue(values, computed) || n.r.hasValue(values, computed)
+}
+
+type aggNode struct {
+	fn     string
+	filter Filter
+}
+
+func (n aggNode) eval(values, _ map[string]float64) float64 {
+	var count int
+	var ret float64
+	for key, v := range values {
+		if v != v || !n.filter.Match(splitSeriesKey(key)) {
+			continue
+		}
+		switch {
+		case count == 0:
+			ret = v
+		case n.fn == "min":
+			ret = min(ret, v)
+		case n.fn == "max":
+			ret = max(ret, v)
+		default:
+			ret += v
+		}
+		count++
+	}
+	switch n.fn {
+	case "count":
+		return float64(count)
+	case "avg":
+		if count == 0 {
+			return math.NaN()
+		}
+		return ret / float64(count)
+	case "sum":
+		return ret
+	default:
+		if count == 0 {
+			return math.NaN()
+		}
+		return ret
+	}
+}
+
+func (n aggNode) hasValue(values, _ map[string]float64) bool {
+	for key, v := range values {
+		if v == v && n.filter.Match(splitSeriesKey(key)) {
+			return true
+		}
+	}
+	return false
+}
+
+var exprFuncs = map[string]bool{"sum": true, "avg": true, "min": true, "max": true, "count": true}
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokNum
+	tokIdent
+	tokOp // + - * / ( ) ,
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+type exprParser struct {
+	src string
+	pos int
+	tok token
+}
+
+func (p *exprParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("expr %q: at %d: %s", p.src, p.tok.pos, fmt.Sprintf(format, args...))
+}
+
+// next reads the next token into p.tok.
+func (p *exprParser) next() error {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.src) {
+		p.tok = token{kind: tokEOF, pos: start}
+		return nil
+	}
+	ch := p.src[p.pos]
+	switch {
+	case strings.IndexByte("+-*/(),", ch) >= 0:
+		p.pos++
+		p.tok = token{kind: tokOp, text: string(ch), pos: start}
+	case ch >= '0' && ch <= '9' || ch == '.':
+		for p.pos < len(p.src) && isNumChar(p.src, p.pos) {
+			p.pos++
+		}
+		p.tok = token{kind: tokNum, text: p.src[start:p.pos], pos: start}
+	case isIdentChar(ch):
+		for p.pos < len(p.src) {
+			c := p.src[p.pos]
+			if c == '[' {
+				// a character class of a pattern, e.g. name[1-3]
+				end := strings.IndexByte(p.src[p.pos:], ']')
+				if end < 0 {
+					p.tok = token{pos: p.pos}
+					return p.errorf("missing ']'")
+				}
+				p.pos += end + 1
+			} else if isIdentChar(c) {
+				p.pos++
+			} else {
+				break
+			}
+		}
+		p.tok = token{kind: tokIdent, text: p.src[start:p.pos], pos: start}
+	default:
+		p.tok = token{pos: start}
+		return p.errorf("unexpected %q", string(ch))
+	}
+	return nil
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == ':' || c == '.' || c == '?' || c == '*' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func isNumChar(s string, i int) bool {
+	c := s[i]
+	if (c >= '0' && c <= '9') || c == '.' || c == 'e' || c == 'E' {
+		return true
+	}
+	// sign of the exponent
+	return (c == '+' || c == '-') && i > 0 && (s[i-1] == 'e' || s[i-1] == 'E')
+}
+
+// parseSum parses: term (('+'|'-') term)*
+func (p *exprParser) parseSum() (exprNode, error) {
+	l, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOp && (p.tok.text == "+" || p.tok.text == "-") {
+		op := p.tok.text[0]
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		r, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		l = binNode{op: op, l: l, r: r}
+	}
+	return l, nil
+}
+
+// parseTerm parses: unary (('*'|'/') unary)*
+func (p *exprParser) parseTerm() (exprNode, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOp && (p.tok.text == "*" || p.tok.text == "/") {
+		op := p.tok.text[0]
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = binNode{op: op, l: l, r: r}
+	}
+	return l, nil
+}
+
+// parseUnary parses: '-' unary | primary
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.tok.kind == tokOp && p.tok.text == "-" {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return negNode{x: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+// parsePrimary parses: number | '(' sum ')' | func '(' names ')' | name
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokNum:
+		v, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", tok.text)
+		}
+		return numNode(v), p.next()
+	case tokIdent:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind == tokOp && p.tok.text == "(" {
+			if !exprFuncs[tok.text] {
+				return nil, fmt.Errorf("expr %q: at %d: unknown function %q", p.src, tok.pos, tok.text)
+			}
+			return p.parseAggregate(tok.text)
+		}
+		if IsFilterPattern(tok.text) {
+			return nil, fmt.Errorf("expr %q: at %d: pattern %q should be in an aggregate function", p.src, tok.pos, tok.text)
+		}
+		return refNode(tok.text), nil
+	case tokOp:
+		if tok.text == "(" {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			x, err := p.parseSum()
+			if err != nil {
+				return nil, err
+			}
+			if p.tok.kind != tokOp || p.tok.text != ")" {
+				return nil, p.errorf("missing ')'")
+			}
+			return x, p.next()
+		}
+	case tokEOF:
+		return nil, p.errorf("unexpected end of expression")
+	}
+	return nil, p.errorf("unexpected %q", tok.text)
+}
+
+func (p *exprParser) parseAggregate(fn string) (exprNode, error) {
+	var names []string
+	for {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokIdent {
+			return nil, p.errorf("%s() expects metric names", fn)
+		}
+		names = append(names, p.tok.text)
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind == tokOp && p.tok.text == "," {
+			continue
+		}
+		if p.tok.kind == tokOp && p.tok.text == ")" {
+			break
+		}
+		return nil, p.errorf("missing ')'")
+	}
+	filter, err := Compile(names, ':')
+	if err != nil {
+		return nil, p.errorf("%v", err)
+	}
+	return aggNode{fn: fn, filter: filter}, p.next()
+}
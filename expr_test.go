@@ -0,0 +1,76 @@
+package metric
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpr(t *testing.T) {
+	values := map[string]float64{
+		"mem:used":                   512,
+		"mem:total":                  2048,
+		"cpu:0":                      10,
+		"cpu:1":                      30,
+		"cpu:2":                      20,
+		`disk:used{path="/"}`:        100,
+		`disk:used{path="/mnt/c"}`:   300,
+		"net:recv_bytes":             1e3,
+		"net:sent_bytes":             2e3,
+		"metric:name1":               1,
+		"metric:name4":               4,
+		"other:name[1]_not_relevant": 99,
+	}
+	tests := []struct {
+		expr   string
+		expect float64
+	}{
+		{"mem:used / mem:total * 100", 25},
+		{"(mem:total - mem:used) / 1024", 1.5},
+		{"-mem:used + 1e3", 488},
+		{"sum(cpu:*)", 60},
+		{"avg(cpu:*)", 20},
+		{"min(cpu:*)", 10},
+		{"max(cpu:*)", 30},
+		{"count(cpu:*)", 3},
+		{"sum(cpu:*) / count(cpu:*)", 20},
+		{"sum(disk:used)", 400},
+		{"sum(net:recv_bytes, net:sent_bytes) / 1000", 3},
+		{"sum(metric:name[1-3])", 1},
+		{"count(nothing:*)", 0},
+		{"sum(nothing:*)", 0},
+	}
+	for _, tt := range tests {
+		e, err := ParseExpr(tt.expr)
+		require.NoError(t, err, tt.expr)
+		require.InDelta(t, tt.expect, e.Eval(values), 1e-9, tt.expr)
+		require.Equal(t, tt.expr, e.String())
+	}
+
+	// missing values
+	require.True(t, math.IsNaN(MustParseExpr("mem:free / mem:total").Eval(values)))
+	require.True(t, math.IsNaN(MustParseExpr("avg(nothing:*)").Eval(values)))
+	// a labeled series is not referred by the name
+	require.True(t, math.IsNaN(MustParseExpr("disk:used").Eval(values)))
+}
+
+func TestExprErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"mem:used /",
+		"(mem:used",
+		"cpu:*",
+		"mem:used*100",
+		"median(cpu:*)",
+		"sum()",
+		"sum(cpu:*",
+		"sum(1)",
+		"mem:used # 2",
+		"sum(metric:name[1-3)",
+	} {
+		_, err := ParseExpr(expr)
+		require.Error(t, err, expr)
+	}
+	require.Panics(t, func() { MustParseExpr("(") })
+}
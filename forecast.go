@@ -0,0 +1,228 @@
+package metric
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// the maximum number of bins ahead that the forecasts reach the threshold in
+const forecastSearchLimit = 10000
+
+// NewLinearForecast returns a Deriver that forecasts the next horizon bins
+// by the least-squares trend line over the last windowSize bins.
+func NewLinearForecast(id string, windowSize int, horizon int, opts ...ForecastOption) Deriver {
+	f := &Forecast{id: id, windowSize: max(windowSize, 2), horizon: max(horizon, 1)}
+	for _, o := range opts {
+		o(f)
+	}
+	return f
+}
+
+// NewHoltWintersForecast returns a Deriver that forecasts the next horizon bins
+// by the additive Holt-Winters method of the season in bins, e.g. 24 for the daily season of hourly bins.
+// The window is at least two seasons, which are required to initialize the method.
+// The default smoothing factors are alpha 0.5, beta 0.1 and gamma 0.3, see ForecastSmoothing.
+func NewHoltWintersForecast(id string, windowSize int, season int, horizon int, opts ...ForecastOption) Deriver {
+	season = max(season, 1)
+	f := &Forecast{
+		id:         id,
+		windowSize: max(windowSize, 2*season),
+		horizon:    max(horizon, 1),
+		season:     season,
+		alpha:      0.5,
+		beta:       0.1,
+		gamma:      0.3,
+	}
+	for _, o := range opts {
+		o(f)
+	}
+	return f
+}
+
+type ForecastOption func(*Forecast)
+
+// ForecastThreshold sets the upper limit, e.g. the capacity of a disk,
+// to estimate the time until the forecast reaches it.
+func ForecastThreshold(threshold float64) ForecastOption {
+	return func(f *Forecast) {
+		f.threshold = threshold
+		f.hasThreshold = true
+	}
+}
+
+// ForecastField sets the field of the values to forecast, default is the primary field, see FieldValue.
+func ForecastField(field string) ForecastOption {
+	return func(f *Forecast) {
+		f.field = field
+	}
+}
+
+// ForecastSmoothing sets the smoothing factors of Holt-Winters in (0, 1),
+// of the level, the trend and the season.
+func ForecastSmoothing(alpha, beta, gamma float64) ForecastOption {
+	return func(f *Forecast) {
+		f.alpha, f.beta, f.gamma = alpha, beta, gamma
+	}
+}
+
+var _ IntervalDeriver = Forecast{}
+
+// Forecast derives a ForecastValue from the window of the bins including the current one.
+// The null bins and the bins without samples are skipped by the linear forecast,
+// and filled with the previous value by Holt-Winters.
+type Forecast struct {
+	id           string
+	field        string
+	windowSize   int
+	horizon      int
+	season       int // zero for the linear forecast
+	alpha        float64
+	beta         float64
+	gamma        float64
+	threshold    float64
+	hasThreshold bool
+}
+
+func (f Forecast) ID() string {
+	return f.id
+}
+
+func (f Forecast) WindowSize() int {
+	return f.windowSize
+}
+
+// Derive forecasts assuming the bins are one second.
+func (f Forecast) Derive(values []Value) Value {
+	return f.DeriveInterval(values, time.Second)
+}
+
+func (f Forecast) DeriveInterval(values []Value, interval time.Duration) Value {
+	ret := &ForecastValue{TimeToThreshold: -1}
+	var xs, ys []float64
+	for i, v := range values {
+		if y, ok := primaryFieldValue(v, f.field); ok {
+			xs = append(xs, float64(i))
+			ys = append(ys, y)
+		}
+	}
+	if f.season > 0 {
+		f.holtWinters(ret, xs, ys, len(values), interval)
+	} else {
+		f.linear(ret, xs, ys, len(values), interval)
+	}
+	return ret
+}
+
+func (f Forecast) linear(ret *ForecastValue, xs, ys []float64, n int, interval time.Duration) {
+	if len(ys) < 2 {
+		return
+	}
+	var mx, my float64
+	for i := range xs {
+		mx += xs[i]
+		my += ys[i]
+	}
+	mx /= float64(len(xs))
+	my /= float64(len(ys))
+	var sxy, sxx float64
+	for i := range xs {
+		sxy += (xs[i] - mx) * (ys[i] - my)
+		sxx += (xs[i] - mx) * (xs[i] - mx)
+	}
+	slope := sxy / sxx
+	cur := float64(n - 1)
+	ret.Bins = len(ys)
+	ret.Fitted = my + slope*(cur-mx)
+	ret.Slope = slope / interval.Seconds()
+	ret.Values = make([]float64, f.horizon)
+	for k := range ret.Values {
+		ret.Values[k] = ret.Fitted + slope*float64(k+1)
+	}
+	if !f.hasThreshold {
+		return
+	}
+	if ret.Fitted >= f.threshold {
+		ret.TimeToThreshold = 0
+	} else if bins := (f.threshold - ret.Fitted) / slope; slope > 0 && bins <= forecastSearchLimit {
+		ret.TimeToThreshold = time.Duration(bins * float64(interval))
+	}
+}
+
+func (f Forecast) holtWinters(ret *ForecastValue, xs, ys []float64, n int, interval time.Duration) {
+	m := f.season
+	if len(ys) == 0 || n-int(xs[0]) < 2*m {
+		return
+	}
+	// fill the missing bins from the first observed one
+	y := make([]float64, 0, n-int(xs[0]))
+	for i, j := int(xs[0]), 0; i < n; i++ {
+		if j < len(xs) && int(xs[j]) == i {
+			y = append(y, ys[j])
+			j++
+		} else {
+			y = append(y, y[len(y)-1])
+		}
+	}
+	// initialize by the means of the first two seasons, at the end of the first season
+	var mean1, mean2 float64
+	for i := 0; i < m; i++ {
+		mean1 += y[i]
+		mean2 += y[m+i]
+	}
+	mean1 /= float64(m)
+	mean2 /= float64(m)
+	trend := (mean2 - mean1) / float64(m)
+	center := float64(m-1) / 2
+	level := mean1 + trend*center
+	seasonal := make([]float64, m)
+	for i := 0; i < m; i++ {
+		seasonal[i] = y[i] - (mean1 + trend*(float64(i)-center))
+	}
+	for t := m; t < len(y); t++ {
+		s := seasonal[t%m]
+		prev := level
+		level = f.alpha*(y[t]-s) + (1-f.alpha)*(level+trend)
+		trend = f.beta*(level-prev) + (1-f.beta)*trend
+		seasonal[t%m] = f.gamma*(y[t]-level) + (1-f.gamma)*s
+	}
+	last := len(y) - 1
+	forecast := func(k int) float64 {
+		return level + float64(k)*trend + seasonal[(last+k)%m]
+	}
+	ret.Bins = len(ys)
+	ret.Fitted = forecast(0)
+	ret.Slope = trend / interval.Seconds()
+	ret.Values = make([]float64, f.horizon)
+	for k := range ret.Values {
+		ret.Values[k] = forecast(k + 1)
+	}
+	if !f.hasThreshold {
+		return
+	}
+	if ret.Fitted >= f.threshold {
+		ret.TimeToThreshold = 0
+		return
+	}
+	for k := 1; k <= forecastSearchLimit; k++ {
+		if forecast(k) >= f.threshold {
+			ret.TimeToThreshold = time.Duration(k) * interval
+			return
+		}
+	}
+}
+
+// ForecastValue is the value of Forecast. TimeToThreshold is the time from the current bin
+// until the forecast reaches the threshold, zero if the fitted value has reached it already,
+// and -1 if the threshold is not set or the forecast does not reach it within 10000 bins.
+type ForecastValue struct {
+	Bins            int           `json:"bins"`   // number of the bins with samples in the window
+	Fitted          float64       `json:"fitted"` // fitted value of the current bin
+	Slope           float64       `json:"slope"`  // trend per second
+	Values          []float64     `json:"values"` // forecasts of the next bins
+	TimeToThreshold time.Duration `json:"time_to_threshold"`
+}
+
+func (fv *ForecastValue) String() string {
+	b, _ := json.Marshal(fv)
+	return string(b)
+}
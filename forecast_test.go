@@ -0,0 +1,100 @@
+package metric
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinearForecast(t *testing.T) {
+	gauge := func(v float64) Value { return &GaugeValue{Samples: 1, Sum: v, Value: v} }
+	f := NewLinearForecast("fc", 5, 3, ForecastThreshold(100))
+	fv := f.(IntervalDeriver).DeriveInterval([]Value{gauge(10), nil, gauge(30), &GaugeValue{}, gauge(50)}, 2*time.Second).(*ForecastValue)
+	require.Equal(t, 3, fv.Bins)
+	require.InDelta(t, 50, fv.Fitted, 1e-9)
+	require.InDelta(t, 5, fv.Slope, 1e-9)
+	require.InDeltaSlice(t, []float64{60, 70, 80}, fv.Values, 1e-9)
+	require.Equal(t, 10*time.Second, fv.TimeToThreshold)
+
+	v, ok := FieldValue(fv, "time_to_threshold")
+	require.True(t, ok)
+	require.Equal(t, float64(10*time.Second), v)
+	v, ok = FieldValue(fv, "horizon")
+	require.True(t, ok)
+	require.InDelta(t, 80, v, 1e-9)
+
+	// a decreasing trend does not reach the threshold
+	fv = f.Derive([]Value{gauge(50), gauge(40)}).(*ForecastValue)
+	require.Equal(t, time.Duration(-1), fv.TimeToThreshold)
+	_, ok = FieldValue(fv, "time_to_threshold")
+	require.False(t, ok)
+	// a near-zero slope does not overflow
+	fv = f.Derive([]Value{gauge(50), gauge(50 + 1e-12)}).(*ForecastValue)
+	require.Equal(t, time.Duration(-1), fv.TimeToThreshold)
+	fv = f.Derive([]Value{gauge(0), gauge(0.01)}).(*ForecastValue)
+	require.InDelta(t, 9999*time.Second, fv.TimeToThreshold, float64(time.Millisecond))
+	// reached already
+	fv = f.Derive([]Value{gauge(100), gauge(120)}).(*ForecastValue)
+	require.Equal(t, time.Duration(0), fv.TimeToThreshold)
+
+	fv = f.Derive([]Value{nil, gauge(1)}).(*ForecastValue)
+	require.Equal(t, 0, fv.Bins)
+	_, ok = FieldValue(fv, "next")
+	require.False(t, ok)
+}
+
+func TestHoltWintersForecast(t *testing.T) {
+	const season = 6
+	y := func(t int) float64 {
+		return 100 + 2*float64(t) + 10*math.Sin(2*math.Pi*float64(t)/season)
+	}
+	var values []Value
+	for i := range 8 * season {
+		values = append(values, &GaugeValue{Samples: 1, Sum: y(i), Value: y(i)})
+	}
+	f := NewHoltWintersForecast("hw", len(values), season, season, ForecastThreshold(250))
+	require.Equal(t, len(values), f.WindowSize())
+	fv := f.Derive(values).(*ForecastValue)
+	require.Equal(t, len(values), fv.Bins)
+	require.InDelta(t, 2, fv.Slope, 0.2)
+	for k, v := range fv.Values {
+		require.InDelta(t, y(len(values)+k), v, 2, "k=%d", k)
+	}
+	k := 1
+	for y(len(values)-1+k) < 250 {
+		k++
+	}
+	require.InDelta(t, time.Duration(k)*time.Second, fv.TimeToThreshold, float64(time.Second))
+
+	// needs two seasons
+	fv = f.Derive(values[:2*season-1]).(*ForecastValue)
+	require.Equal(t, 0, fv.Bins)
+}
+
+func TestTimeSeriesForecast(t *testing.T) {
+	clk := NewFakeClock(time.Date(2025, 07, 21, 17, 31, 12, 0, time.UTC))
+	ts := NewTimeSeries(10*time.Second, 10, NewOdometer(),
+		WithTimeSeriesClock(clk),
+		WithTimeSeriesDerivers(NewLinearForecast("fill", 5, 6, ForecastThreshold(1000))),
+	)
+	for i := range 5 {
+		ts.Add(float64(100 * (i + 1)))
+		clk.Advance(10 * time.Second)
+	}
+	ts.Add(600)
+	times, values := ts.LastN(1)
+	fv := values[0].(*OdometerValue).DerivedValues["fill"].(*ForecastValue)
+	require.InDelta(t, 10, fv.Slope, 1e-9)
+	require.InDelta(t, 40*time.Second, fv.TimeToThreshold, 1)
+
+	ss := Snapshot{Times: times, Values: values, Interval: 10 * time.Second,
+		Meta: SeriesInfo{MeasureName: "disk", MeasureType: OdometerType(UnitBytes)}}
+	series := ss.derivedToSeries(Chart{})
+	require.Len(t, series, 1)
+	require.Equal(t, "disk#fill.forecast", series[0].Name)
+	require.Equal(t, map[string]any{"type": "dashed"}, series[0].LineStyle)
+	require.Len(t, series[0].Data, 7)
+	require.Equal(t, times[0].Add(60*time.Second).UnixMilli(), series[0].Data[6].Time)
+}
@@ -2,6 +2,7 @@ package metric
 
 import (
 	"encoding/json"
+	"fmt"
 	"sync"
 )
 
@@ -60,6 +61,22 @@ func (fs *Gauge) Add(v float64) {
 	fs.samples++
 }
 
+func (fs *Gauge) Merge(v Value) error {
+	gv, ok := v.(*GaugeValue)
+	if !ok {
+		return fmt.Errorf("%w: %T into gauge", ErrNotMergeable, v)
+	}
+	if gv.Samples == 0 {
+		return nil
+	}
+	fs.Lock()
+	defer fs.Unlock()
+	fs.value = gv.Value
+	fs.sum += gv.Sum
+	fs.samples += gv.Samples
+	return nil
+}
+
 func (fs *Gauge) Produce(reset bool) Value {
 	fs.Lock()
 	defer fs.Unlock()
@@ -85,7 +102,7 @@ type GaugeValue struct {
 	Sum     float64 `json:"sum"`
 	Value   float64 `json:"value"`
 	// Optional derived values, such as moving averages
-	DerivedValues map[string]Value `json:"derived,omitempty"`
+	DerivedValues DerivedValues `json:"derived,omitempty"`
 }
 
 func (gp *GaugeValue) String() string {
@@ -95,7 +112,7 @@ func (gp *GaugeValue) String() string {
 
 func (cp *GaugeValue) SetDerivedValue(name string, value Value) {
 	if cp.DerivedValues == nil {
-		cp.DerivedValues = make(map[string]Value)
+		cp.DerivedValues = make(DerivedValues)
 	}
 	cp.DerivedValues[name] = value
 }
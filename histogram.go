@@ -1,9 +1,11 @@
 package metric
 
 import (
+	"cmp"
 	"encoding/json"
 	"fmt"
 	"math"
+	"slices"
 	"sync"
 )
 
@@ -116,6 +118,54 @@ func (h *Histogram) Add(value float64) {
 	h.bins = append(h.bins, newBin)
 }
 
+// Merge adds the buckets of the sketch of the HistogramValue as bins if it has one,
+// see SketchHistogram. Otherwise, it adds the quantile values as bins weighted by the spacing
+// of the quantiles, e.g. p50, p90 and p99 get 50%, 40% and 10% of the samples,
+// whose merged quantiles are rough approximations.
+func (h *Histogram) Merge(v Value) error {
+	hv, ok := v.(*HistogramValue)
+	if !ok {
+		return fmt.Errorf("%w: %T into histogram", ErrNotMergeable, v)
+	}
+	if hv.Samples == 0 || len(hv.Values) == 0 {
+		return nil
+	}
+	h.Lock()
+	defer func() {
+		h.trim()
+		h.Unlock()
+	}()
+	h.samples += hv.Samples
+	if hv.Sketch != nil {
+		hv.Sketch.buckets(func(value float64, count float64) {
+			h.insert(HistBin{value: value, count: count})
+		})
+		return nil
+	}
+	prev := 0.0
+	for i, value := range hv.Values {
+		weight := 1 / float64(len(hv.Values))
+		if len(hv.P) == len(hv.Values) {
+			if i == len(hv.Values)-1 {
+				weight = 1 - prev
+			} else {
+				weight = hv.P[i] - prev
+				prev = hv.P[i]
+			}
+		}
+		h.insert(HistBin{value: value, count: weight * float64(hv.Samples)})
+	}
+	return nil
+}
+
+// insert adds the bin in the order of the values.
+func (h *Histogram) insert(bin HistBin) {
+	idx, _ := slices.BinarySearchFunc(h.bins, bin.value, func(b HistBin, v float64) int {
+		return cmp.Compare(b.value, v)
+	})
+	h.bins = slices.Insert(h.bins, idx, bin)
+}
+
 func (h *Histogram) trim() {
 	if h.maxBins <= 0 {
 		h.maxBins = 100
@@ -210,9 +260,11 @@ type HistogramValue struct {
 	Samples int64     `json:"samples"`
 	P       []float64 `json:"p"`
 	Values  []float64 `json:"values"`
+	// Sketch of the values, produced by SketchHistogram
+	Sketch *Sketch `json:"sketch,omitempty"`
 
 	// Optional derived values, such as moving averages
-	DerivedValues map[string]Value `json:"derived,omitempty"`
+	DerivedValues DerivedValues `json:"derived,omitempty"`
 }
 
 func (hp HistogramValue) String() string {
@@ -222,7 +274,7 @@ func (hp HistogramValue) String() string {
 
 func (hp *HistogramValue) SetDerivedValue(name string, value Value) {
 	if hp.DerivedValues == nil {
-		hp.DerivedValues = make(map[string]Value)
+		hp.DerivedValues = make(DerivedValues)
 	}
 	hp.DerivedValues[name] = value
 }
@@ -68,3 +68,29 @@ func TestHistogramJSON(t *testing.T) {
 		require.Equal(t, h.bins[i].count, h2.bins[i].count)
 	}
 }
+
+func TestHistogramMerge(t *testing.T) {
+	h := NewHistogram(100)
+	for range 2 {
+		src := NewHistogram(100)
+		for i := 1; i <= 100; i++ {
+			src.Add(float64(i))
+		}
+		require.NoError(t, h.Merge(src.Produce(false)))
+	}
+	hv := h.Produce(false).(*HistogramValue)
+	require.Equal(t, int64(200), hv.Samples)
+	require.Equal(t, []float64{50, 90, 99}, hv.Values)
+}
+
+func TestHistogramMergeSketch(t *testing.T) {
+	src := NewSketchHistogram(0.01)
+	for i := 1; i <= 1000; i++ {
+		src.Add(float64(i))
+	}
+	h := NewHistogram(100)
+	require.NoError(t, h.Merge(src.Produce(false)))
+	// the buckets of the sketch keep the distribution
+	require.InDelta(t, 500, h.Quantile(0.5), 25)
+	require.InDelta(t, 990, h.Quantile(0.99), 25)
+}
@@ -0,0 +1,292 @@
+package metric
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ContextInput is an optional interface of Input.
+// If an input implements it, the collector calls GatherContext instead of Gather,
+// the context is canceled when the input times out or the collector is stopped.
+type ContextInput interface {
+	GatherContext(ctx context.Context, g *Gather) error
+}
+
+// ContextInputFunc is a function type that implements both Input and ContextInput.
+type ContextInputFunc func(context.Context, *Gather) error
+
+var _ Input = ContextInputFunc(nil)
+var _ ContextInput = ContextInputFunc(nil)
+
+func (f ContextInputFunc) Gather(g *Gather) error {
+	return f(context.Background(), g)
+}
+
+func (f ContextInputFunc) GatherContext(ctx context.Context, g *Gather) error {
+	return f(ctx, g)
+}
+
+var ErrInputTimeout = errors.New("input timed out")
+var ErrInputBusy = errors.New("input is still gathering")
+var ErrInputNotFound = errors.New("input not found")
+var ErrInputRemoved = errors.New("input removed")
+
+// InputOption configures an input registered by AddInputWithOptions.
+type InputOption func(*inputEntry)
+
+// InputName sets the name of the input, which is used in logs and InputStatus.
+// If not set, the Name() method of the input is used if exists,
+// otherwise the type name of the input.
+func InputName(name string) InputOption {
+	return func(in *inputEntry) {
+		in.name = name
+	}
+}
+
+// InputTimeout sets the maximum duration of a single gathering of the input.
+// It overrides the default timeout set by WithInputTimeout.
+// Zero means no timeout.
+func InputTimeout(timeout time.Duration) InputOption {
+	return func(in *inputEntry) {
+		in.timeout = timeout
+	}
+}
+
+// InputInterval sets the sampling interval of the input.
+// The input is scheduled independently of the sampling interval of the collector,
+// e.g. a cheap input can be gathered every second while an expensive one every minute.
+func InputInterval(interval time.Duration) InputOption {
+	return func(in *inputEntry) {
+		in.interval = interval
+	}
+}
+
+// InputJitter delays each gathering of the input by a random duration up to jitter,
+// which spreads the load of the inputs that have the same interval.
+func InputJitter(jitter time.Duration) InputOption {
+	return func(in *inputEntry) {
+		in.jitter = jitter
+	}
+}
+
+// InputInitialDelay delays the first gathering of the input.
+// If it is set, the input is not gathered when it is added to the collector.
+func InputInitialDelay(delay time.Duration) InputOption {
+	return func(in *inputEntry) {
+		in.initialDelay = delay
+	}
+}
+
+// InputStatus reports the state of a registered input.
+type InputStatus struct {
+	Name     string        `json:"name"`
+	Interval time.Duration `json:"interval,omitempty"` // zero if it follows the collector's interval
+	Running  bool          `json:"running"`            // a gathering is in progress
+	Timeouts int64         `json:"timeouts"`           // number of gatherings that timed out
+	Errors   int64         `json:"errors"`             // number of gatherings that returned error
+	LastSeen time.Time     `json:"last_seen"`          // time of the last successful gathering, zero if never
+	Absent   bool          `json:"absent,omitempty"`   // see WithAbsence
+}
+
+type inputEntry struct {
+	input        Input
+	name         string
+	timeout      time.Duration
+	interval     time.Duration
+	jitter       time.Duration
+	initialDelay time.Duration
+	running      atomic.Bool
+	timeouts     atomic.Int64
+	errors       atomic.Int64
+	added        time.Time
+	lastSeen     atomic.Pointer[time.Time] // time of the last successful gathering
+	absent       atomic.Bool
+
+	// removal stops the schedule and waits for the in-flight gathering
+	mu       sync.Mutex
+	removed  bool
+	inflight sync.WaitGroup
+	stopCh   chan struct{}
+}
+
+func newInputEntry(input Input, defaultTimeout time.Duration, opts ...InputOption) *inputEntry {
+	in := &inputEntry{
+		input:   input,
+		timeout: defaultTimeout,
+		stopCh:  make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(in)
+	}
+	if in.name == "" {
+		in.name = pluginName(input)
+	}
+	return in
+}
+
+func (in *inputEntry) status() InputStatus {
+	return InputStatus{
+		Name:     in.name,
+		Interval: in.interval,
+		Running:  in.running.Load(),
+		Timeouts: in.timeouts.Load(),
+		Errors:   in.errors.Load(),
+		LastSeen: in.lastSeenTime(),
+		Absent:   in.absent.Load(),
+	}
+}
+
+func (in *inputEntry) lastSeenTime() time.Time {
+	if tm := in.lastSeen.Load(); tm != nil {
+		return *tm
+	}
+	return time.Time{}
+}
+
+// scheduled reports whether the input runs on its own schedule
+// instead of the collector's sampling ticks.
+func (in *inputEntry) scheduled() bool {
+	return in.interval > 0 || in.jitter > 0 || in.initialDelay > 0
+}
+
+// nextJitter returns a random delay for the next gathering.
+func (in *inputEntry) nextJitter() time.Duration {
+	if in.jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(in.jitter)))
+}
+
+// gather calls the input with the context that expires after the timeout of the input.
+// If the input does not return in time, the gathering is abandoned and
+// the input is not called again until the abandoned call returns.
+func (in *inputEntry) gather(ctx context.Context) (*Gather, error) {
+	in.mu.Lock()
+	if in.removed {
+		in.mu.Unlock()
+		return nil, fmt.Errorf("input %s: %w", in.name, ErrInputRemoved)
+	}
+	if !in.running.CompareAndSwap(false, true) {
+		in.mu.Unlock()
+		return nil, fmt.Errorf("input %s: %w", in.name, ErrInputBusy)
+	}
+	in.inflight.Add(1)
+	in.mu.Unlock()
+
+	g := &Gather{}
+	if in.timeout <= 0 {
+		defer in.done()
+		if err := in.call(ctx, g); err != nil {
+			in.errors.Add(1)
+			return nil, err
+		}
+		return g, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, in.timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		defer in.done()
+		done <- in.call(ctx, g)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			in.errors.Add(1)
+			return nil, err
+		}
+		return g, nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			in.timeouts.Add(1)
+			return nil, fmt.Errorf("input %s: %w after %s", in.name, ErrInputTimeout, in.timeout)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func (in *inputEntry) done() {
+	in.running.Store(false)
+	in.inflight.Done()
+}
+
+// remove stops the schedule of the input, and calls DeInit() of the input
+// after the in-flight gathering returns. If wait is zero or negative, it blocks until DeInit() returns.
+// Otherwise it returns ErrInputTimeout if DeInit() does not return within wait,
+// and DeInit() is still called when the gathering returns. Removing the input again does nothing.
+func (in *inputEntry) remove(wait time.Duration) error {
+	in.mu.Lock()
+	if in.removed {
+		in.mu.Unlock()
+		return nil
+	}
+	in.removed = true
+	close(in.stopCh)
+	in.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		in.inflight.Wait()
+		deInit(in.input)
+	}()
+	if wait <= 0 {
+		<-done
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("input %s: %w after %s while removing", in.name, ErrInputTimeout, wait)
+	}
+}
+
+func (in *inputEntry) call(ctx context.Context, g *Gather) error {
+	if ci, ok := in.input.(ContextInput); ok {
+		return ci.GatherContext(ctx, g)
+	}
+	return in.input.Gather(g)
+}
+
+// pluginName returns the name of an input or output.
+func pluginName(v any) string {
+	if named, ok := v.(interface{ Name() string }); ok {
+		return named.Name()
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// sameHandle reports whether a and b are the same input or output.
+// Values of uncomparable types are never the same.
+func sameHandle(a, b any) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	if ta, tb := reflect.TypeOf(a), reflect.TypeOf(b); ta != tb || !ta.Comparable() {
+		return false
+	}
+	return a == b
+}
+
+// deInit calls DeInit() of the input or output if exists.
+func deInit(v any) {
+	switch d := v.(type) {
+	case interface{ DeInit() }:
+		d.DeInit()
+	case interface{ DeInit() error }:
+		if err := d.DeInit(); err != nil {
+			slog.Error("Error in DeInit", "name", pluginName(v), "error", err)
+		}
+	}
+}
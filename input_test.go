@@ -0,0 +1,219 @@
+package metric
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInputTimeout(t *testing.T) {
+	c := NewCollector(WithInputTimeout(50 * time.Millisecond))
+	calls := 0
+	hung := ContextInputFunc(func(ctx context.Context, g *Gather) error {
+		calls++
+		if calls > 1 {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		g.Add("hung", 1, GaugeType(UnitShort))
+		return nil
+	})
+	require.NoError(t, c.AddInputWithOptions(hung, InputName("hung")))
+	require.NoError(t, c.AddInputFunc(func(g *Gather) error {
+		g.Add("fine", 1, GaugeType(UnitShort))
+		return nil
+	}))
+
+	c.runInputs(time.Now())
+	// the hung input is skipped, the next input and the noop tick are delivered
+	g := <-c.recvCh
+	require.Equal(t, "fine", g.measures[0].Name)
+	g = <-c.recvCh
+	require.True(t, g.noop)
+
+	status := c.InputStatus()
+	require.Len(t, status, 2)
+	require.Equal(t, "hung", status[0].Name)
+	require.Equal(t, int64(1), status[0].Timeouts)
+	require.Equal(t, "*metric.InputFuncWrapper", status[1].Name)
+	require.Equal(t, int64(0), status[1].Timeouts)
+	c.Stop()
+}
+
+func TestInputCancelOnStop(t *testing.T) {
+	c := NewCollector()
+	started := make(chan struct{})
+	canceled := make(chan struct{})
+	first := true
+	err := c.AddInput(ContextInputFunc(func(ctx context.Context, g *Gather) error {
+		if first {
+			first = false
+			return nil
+		}
+		close(started)
+		<-ctx.Done()
+		close(canceled)
+		return ctx.Err()
+	}))
+	require.NoError(t, err)
+
+	go c.runInputs(time.Now())
+	<-started
+	c.Stop()
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("input is not canceled by Stop")
+	}
+}
+
+func TestInputInterval(t *testing.T) {
+	c := NewCollector(WithSamplingInterval(time.Hour))
+	var fast, slow, delayed atomic.Int64
+	require.NoError(t, c.AddInputWithOptions(&InputFuncWrapper{func(g *Gather) error {
+		fast.Add(1)
+		return nil
+	}}, InputInterval(10*time.Millisecond)))
+	require.NoError(t, c.AddInputWithOptions(&InputFuncWrapper{func(g *Gather) error {
+		slow.Add(1)
+		return nil
+	}}, InputInterval(time.Hour), InputJitter(time.Millisecond)))
+	require.NoError(t, c.AddInputWithOptions(&InputFuncWrapper{func(g *Gather) error {
+		delayed.Add(1)
+		return nil
+	}}, InputInitialDelay(20*time.Millisecond)))
+	// the initial gathering is skipped for the delayed input
+	require.Equal(t, int64(1), fast.Load())
+	require.Equal(t, int64(1), slow.Load())
+	require.Equal(t, int64(0), delayed.Load())
+
+	c.Start()
+	require.Eventually(t, func() bool {
+		return fast.Load() >= 5 && delayed.Load() >= 1
+	}, time.Second, 5*time.Millisecond)
+	require.Equal(t, int64(1), slow.Load())
+	c.Stop()
+
+	status := c.InputStatus()
+	require.Equal(t, 10*time.Millisecond, status[0].Interval)
+	require.Equal(t, time.Hour, status[1].Interval)
+}
+
+type testPlugin struct {
+	name     string
+	gathered atomic.Int64
+	products atomic.Int64
+	deInit   atomic.Int64
+}
+
+func (tp *testPlugin) Name() string { return tp.name }
+
+func (tp *testPlugin) Gather(g *Gather) error {
+	tp.gathered.Add(1)
+	g.Add(tp.name, 1, CounterType(UnitShort))
+	return nil
+}
+
+func (tp *testPlugin) Process(p Product) error {
+	tp.products.Add(1)
+	return nil
+}
+
+func (tp *testPlugin) DeInit() { tp.deInit.Add(1) }
+
+func TestRemoveInputAndOutput(t *testing.T) {
+	seriesID, err := NewSeriesID("REMOVE_1S", "1s", 10*time.Millisecond, 10)
+	require.NoError(t, err)
+	c := NewCollector(WithSamplingInterval(10*time.Millisecond), WithSeries(seriesID))
+	in1 := &testPlugin{name: "in1"}
+	in2 := &testPlugin{name: "in2"}
+	out1 := &testPlugin{name: "out1"}
+	require.NoError(t, c.AddInput(in1))
+	require.NoError(t, c.AddInputWithOptions(in2, InputInterval(5*time.Millisecond)))
+	require.NoError(t, c.AddOutput(out1))
+	c.Start()
+	require.Eventually(t, func() bool {
+		return in1.gathered.Load() > 2 && in2.gathered.Load() > 2 && out1.products.Load() > 2
+	}, time.Second, 5*time.Millisecond)
+
+	require.NoError(t, c.RemoveInputByName("in2"))
+	require.NoError(t, c.RemoveInput(in1))
+	require.NoError(t, c.RemoveOutput(out1))
+	require.ErrorIs(t, c.RemoveInput(in1), ErrInputNotFound)
+	require.ErrorIs(t, c.RemoveOutputByName("out1"), ErrOutputNotFound)
+	require.Equal(t, int64(1), in1.deInit.Load())
+	require.Equal(t, int64(1), in2.deInit.Load())
+	require.Equal(t, int64(1), out1.deInit.Load())
+	require.Empty(t, c.InputStatus())
+
+	gathered1, gathered2, products := in1.gathered.Load(), in2.gathered.Load(), out1.products.Load()
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, gathered1, in1.gathered.Load())
+	require.Equal(t, gathered2, in2.gathered.Load())
+	require.Equal(t, products, out1.products.Load())
+	c.Stop()
+	// DeInit is not called again for the removed plugins
+	require.Equal(t, int64(1), in1.deInit.Load())
+	require.Equal(t, int64(1), out1.deInit.Load())
+}
+
+type hungInput struct {
+	testPlugin
+	started chan struct{}
+	release chan struct{}
+}
+
+func (hi *hungInput) Gather(g *Gather) error {
+	close(hi.started)
+	<-hi.release
+	return nil
+}
+
+func TestRemoveHungInput(t *testing.T) {
+	c := NewCollector(WithSamplingInterval(20 * time.Millisecond))
+	defer c.Stop()
+	in := &hungInput{testPlugin: testPlugin{name: "hung"}, started: make(chan struct{}), release: make(chan struct{})}
+	require.NoError(t, c.AddInputWithOptions(in, InputTimeout(0), InputInterval(time.Hour), InputInitialDelay(time.Millisecond)))
+	c.Start()
+	<-in.started
+
+	// the input has no timeout, the wait is bounded by the sampling interval
+	err := c.RemoveInputByName("hung")
+	require.IsType(t, MultipleError{}, err)
+	require.ErrorIs(t, err, ErrInputTimeout)
+	require.Empty(t, c.InputStatus())
+	require.Equal(t, int64(0), in.deInit.Load())
+
+	// DeInit is called when the gathering returns
+	close(in.release)
+	require.Eventually(t, func() bool { return in.deInit.Load() == 1 }, time.Second, 5*time.Millisecond)
+}
+
+func TestStopHungInput(t *testing.T) {
+	c := NewCollector(WithSamplingInterval(20*time.Millisecond), WithInputTimeout(10*time.Millisecond))
+	in := &hungInput{testPlugin: testPlugin{name: "hung"}, started: make(chan struct{}), release: make(chan struct{})}
+	out := &testPlugin{name: "out"}
+	require.NoError(t, c.AddInputWithOptions(in, InputInterval(time.Hour), InputInitialDelay(time.Millisecond)))
+	require.NoError(t, c.AddOutput(out))
+	c.Start()
+	<-in.started
+
+	stopped := make(chan struct{})
+	go func() {
+		c.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop waits for the hung input")
+	}
+	require.Equal(t, int64(1), out.deInit.Load())
+	require.Equal(t, int64(0), in.deInit.Load())
+
+	close(in.release)
+	require.Eventually(t, func() bool { return in.deInit.Load() == 1 }, time.Second, 5*time.Millisecond)
+}
@@ -0,0 +1,82 @@
+package metric
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Labels are the key/value pairs that distinguish the series of a measure.
+// A measure name with different labels fans out into separate time series,
+// e.g. "disk:used_percent" with {path="/"} and {path="/mnt/c"}.
+type Labels map[string]string
+
+// String returns the canonical representation of the labels,
+// e.g. `{host="a",path="/mnt/c"}`, with keys in sorted order.
+// It returns an empty string if there are no labels.
+func (l Labels) String() string {
+	if len(l) == 0 {
+		return ""
+	}
+	keys := l.Keys()
+	var sb strings.Builder
+	sb.WriteString("{")
+	for i, k := range keys {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString(k)
+		sb.WriteString("=")
+		sb.WriteString(strconv.Quote(l[k]))
+	}
+	sb.WriteString("}")
+	return sb.String()
+}
+
+// Keys returns the sorted label keys.
+func (l Labels) Keys() []string {
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// Match reports whether l contains all of the key/value pairs of sub.
+// An empty sub matches any labels.
+func (l Labels) Match(sub Labels) bool {
+	for k, v := range sub {
+		if lv, ok := l[k]; !ok || lv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Copy returns a copy of the labels, or nil if there are no labels.
+func (l Labels) Copy() Labels {
+	if len(l) == 0 {
+		return nil
+	}
+	ret := make(Labels, len(l))
+	for k, v := range l {
+		ret[k] = v
+	}
+	return ret
+}
+
+// SeriesKey returns the key that identifies the time series of a measure
+// with the given labels, e.g. `disk:used_percent{path="/mnt/c"}`.
+// If there are no labels, the key is the measure name itself.
+func SeriesKey(name string, labels Labels) string {
+	return name + labels.String()
+}
+
+// splitSeriesKey returns the measure name part of the series key.
+func splitSeriesKey(key string) string {
+	if idx := strings.IndexByte(key, '{'); idx > 0 {
+		return key[:idx]
+	}
+	return key
+}
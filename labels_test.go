@@ -0,0 +1,39 @@
+package metric
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLabels(t *testing.T) {
+	l := Labels{"path": "/mnt/c", "host": "a"}
+	require.Equal(t, `{host="a",path="/mnt/c"}`, l.String())
+	require.Equal(t, `disk:used_percent{host="a",path="/mnt/c"}`, SeriesKey("disk:used_percent", l))
+	require.Equal(t, "disk:used_percent", SeriesKey("disk:used_percent", nil))
+	require.Equal(t, "disk:used_percent", splitSeriesKey(SeriesKey("disk:used_percent", l)))
+
+	require.True(t, l.Match(nil))
+	require.True(t, l.Match(Labels{"host": "a"}))
+	require.False(t, l.Match(Labels{"host": "b"}))
+	require.False(t, l.Match(Labels{"dev": "sda"}))
+
+	cp := l.Copy()
+	cp["host"] = "b"
+	require.Equal(t, "a", l["host"])
+	require.Nil(t, Labels{}.Copy())
+}
+
+func TestLabelsProduct(t *testing.T) {
+	prd := Product{
+		Name:   "disk:used_percent",
+		Labels: Labels{"path": "/mnt/c"},
+		Value:  &GaugeValue{Samples: 1, Sum: 20, Value: 20},
+		Type:   "gauge",
+		Unit:   UnitPercent,
+	}
+	var parsed Product
+	require.NoError(t, parseProduct(&parsed, prd.String(), true))
+	require.Equal(t, prd.Key(), parsed.Key())
+	require.Equal(t, prd.Value, parsed.Value)
+}
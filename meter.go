@@ -2,6 +2,7 @@ package metric
 
 import (
 	"encoding/json"
+	"fmt"
 	"sync"
 )
 
@@ -79,6 +80,29 @@ func (m *Meter) Add(v float64) {
 	m.samples++
 }
 
+func (m *Meter) Merge(v Value) error {
+	mv, ok := v.(*MeterValue)
+	if !ok {
+		return fmt.Errorf("%w: %T into meter", ErrNotMergeable, v)
+	}
+	if mv.Samples == 0 {
+		return nil
+	}
+	m.Lock()
+	defer m.Unlock()
+	if m.samples == 0 {
+		m.first = mv.First
+		m.min = mv.Min
+		m.max = mv.Max
+	}
+	m.min = min(m.min, mv.Min)
+	m.max = max(m.max, mv.Max)
+	m.sum += mv.Sum
+	m.last = mv.Last
+	m.samples += mv.Samples
+	return nil
+}
+
 func (m *Meter) Produce(reset bool) Value {
 	m.Lock()
 	defer m.Unlock()
@@ -114,7 +138,7 @@ type MeterValue struct {
 	Min     float64 `json:"min"`
 	Max     float64 `json:"max"`
 	// Optional derived values, such as moving averages
-	DerivedValues map[string]Value `json:"derived,omitempty"`
+	DerivedValues DerivedValues `json:"derived,omitempty"`
 }
 
 func (mp *MeterValue) String() string {
@@ -124,7 +148,7 @@ func (mp *MeterValue) String() string {
 
 func (cp *MeterValue) SetDerivedValue(name string, value Value) {
 	if cp.DerivedValues == nil {
-		cp.DerivedValues = make(map[string]Value)
+		cp.DerivedValues = make(DerivedValues)
 	}
 	cp.DerivedValues[name] = value
 }
@@ -30,3 +30,20 @@ func TestMeterJSON(t *testing.T) {
 	require.Equal(t, m.sum, m2.sum)
 	require.Equal(t, m.samples, m2.samples)
 }
+
+func TestMeterMerge(t *testing.T) {
+	m1 := NewMeter()
+	m1.Add(3.0)
+	m1.Add(1.0)
+	m2 := NewMeter()
+	m2.Add(5.0)
+	m2.Add(2.0)
+
+	m := NewMeter()
+	require.NoError(t, m.Merge(m1.Produce(false)))
+	require.NoError(t, m.Merge(NewMeter().Produce(false))) // empty bin
+	require.NoError(t, m.Merge(m2.Produce(false)))
+	require.Equal(t, &MeterValue{Samples: 4, Sum: 11, First: 3, Last: 2, Min: 1, Max: 5}, m.Produce(false))
+
+	require.ErrorIs(t, m.Merge(&CounterValue{}), ErrNotMergeable)
+}
@@ -1,14 +1,16 @@
 package metric
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
-	"expvar"
 	"fmt"
 	"log/slog"
 	"math"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -23,12 +25,31 @@ type Gather struct {
 	measures []Measure
 	ts       time.Time
 	noop     bool
+	input    string // name of the input that gathered
 }
 
 func (g *Gather) Add(name string, value float64, typ Type) {
 	g.measures = append(g.measures, Measure{Name: name, Value: value, Type: typ})
 }
 
+// AddWithLabels adds a measure that is stored in its own time series
+// for each distinct set of labels.
+func (g *Gather) AddWithLabels(name string, labels Labels, value float64, typ Type) {
+	g.measures = append(g.measures, Measure{Name: name, Labels: labels.Copy(), Value: value, Type: typ})
+}
+
+// AddKey adds a key to be counted by the time series of UniqueType,
+// which estimates the number of the distinct keys, e.g. the user IDs.
+// Only the hash of the key is kept, see HashKey.
+func (g *Gather) AddKey(name string, key string, typ Type) {
+	g.measures = append(g.measures, KeyMeasure(name, nil, key, typ))
+}
+
+// AddKeyWithLabels is like AddKey but with labels, see AddWithLabels.
+func (g *Gather) AddKeyWithLabels(name string, labels Labels, key string, typ Type) {
+	g.measures = append(g.measures, KeyMeasure(name, labels.Copy(), key, typ))
+}
+
 func (g *Gather) Filter(filter Filter) {
 	var ms []Measure
 	for _, f := range g.measures {
@@ -40,23 +61,45 @@ func (g *Gather) Filter(filter Filter) {
 }
 
 type Measure struct {
-	Name  string
-	Value float64
-	Type  Type
+	Name   string
+	Labels Labels
+	Value  float64
+	Type   Type
+	// Hash of the key instead of the Value if Hashed, see KeyMeasure
+	Hash   uint64
+	Hashed bool
+}
+
+// KeyMeasure returns a Measure of the hashed key for the time series of UniqueType,
+// which can be sent by Collector.Send.
+func KeyMeasure(name string, labels Labels, key string, typ Type) Measure {
+	return Measure{Name: name, Labels: labels, Type: typ, Hash: HashKey(key), Hashed: true}
+}
+
+// Key returns the key of the time series that the measure belongs to.
+func (m Measure) Key() string {
+	return SeriesKey(m.Name, m.Labels)
 }
 
 type SeriesInfo struct {
 	MeasureName string   `json:"measure_name"`
+	Labels      Labels   `json:"labels,omitempty"`
 	MeasureType Type     `json:"measure_type"`
 	SeriesID    SeriesID `json:"series_id"`
 }
 
+// Key returns the key of the time series, which is the measure name with its labels.
+func (si SeriesInfo) Key() string {
+	return SeriesKey(si.MeasureName, si.Labels)
+}
+
 func (si *SeriesInfo) H() map[string]any {
 	if si == nil {
 		return nil
 	}
 	return H{
 		"name":         si.MeasureName,
+		"labels":       si.Labels,
 		"series_id":    si.SeriesID.ID(),
 		"series_title": si.SeriesID.Title(),
 		"period":       si.SeriesID.period.String(),
@@ -69,50 +112,98 @@ func (si *SeriesInfo) H() map[string]any {
 type Collector struct {
 	sync.Mutex
 
-	inputs     []Input                    // registered input
+	inputs     []*inputEntry              // registered input
 	outputs    []Output                   // registered output
-	timeseries map[string]MultiTimeSeries // measurement_name: multi-timeseries
+	timeseries map[string]MultiTimeSeries // series key (name with labels): multi-timeseries
+	lastSeen   map[string]time.Time       // series key: time of the last measure
+	lastValues map[string]float64         // series key: value gathered since the previous tick
+	lastInputs map[string]string          // series key: name of the input that reported it last
+	computed   []computedMetric
+
+	// eviction of idle time series and the limit of the number of time series
+	metricTTL         time.Duration
+	maxMetrics        int
+	cardinalityPolicy CardinalityPolicy
+	rejected          atomic.Int64
+	evicted           atomic.Int64
+
+	// absence detection of the measures and inputs
+	absenceIntervals int
+	absenceHandler   AbsenceHandler
+	absenceMetric    string
+	absent           map[string]bool // series key: absent
 
 	// only data that match the filter will be stored
 	timeseriesFilter Filter
+	// transform the measures before they are stored
+	processors []Processor
 
 	// periodically collects metrics from inputs
 	samplingInterval time.Duration
+	inputTimeout     time.Duration
 	closeCh          chan struct{}
 	stopWg           sync.WaitGroup
+	started          bool
+	stopped          bool
+	stopOnce         sync.Once
+	doneCh           chan struct{} // closed when the shutdown completes
+	paused           atomic.Bool
+
+	// canceled when the collector is stopped, which cancels running inputs
+	ctx    context.Context
+	cancel context.CancelFunc
 
 	// event-driven measurements
 	recvCh     chan *Gather
 	recvChSize int
+	overflow   OverflowPolicy
+	sampler    overflowSampler
+	dropped    atomic.Int64
 	// a channel to which measurements can be sent.
 	C chan<- *Gather
 
 	// time series configuration
 	series       []SeriesID
+	rollups      map[string]string // series ID: series ID of the rollup source
 	expvarPrefix string
+	registry     Registry
 
 	// persistent storage
 	storage Storage
+
+	clock Clock
 }
 
 // NewCollector creates a new Collector with the specified interval.
 // The interval determines how often the inputs will be collected.
-// The collector will run until Stop() is called.
-// It is safe to call Start() multiple times, but Stop() should be called only once
+// The collector will run until Stop() or Shutdown() is called.
+// It is safe to call Start() and Stop() multiple times, a stopped collector cannot be started again.
 func NewCollector(opts ...CollectorOption) *Collector {
 	c := &Collector{
 		samplingInterval: 10 * time.Second,
 		closeCh:          make(chan struct{}),
+		doneCh:           make(chan struct{}),
 		timeseries:       make(map[string]MultiTimeSeries),
+		lastSeen:         make(map[string]time.Time),
+		lastValues:       make(map[string]float64),
+		lastInputs:       make(map[string]string),
+		absent:           make(map[string]bool),
+		sampler:          overflowSampler{rate: 10},
+		clock:            SystemClock(),
 	}
 	for _, opt := range opts {
 		opt(c)
 	}
+	c.sortRollupSources()
 	if c.recvChSize <= 0 {
 		c.recvChSize = 100
 	}
+	if c.registry == nil {
+		c.registry = NewRegistry()
+	}
 	c.recvCh = make(chan *Gather, c.recvChSize)
 	c.C = c.recvCh
+	c.ctx, c.cancel = context.WithCancel(context.Background())
 	return c
 }
 
@@ -132,19 +223,125 @@ func WithSeries(seriesID ...SeriesID) CollectorOption {
 	}
 }
 
+// WithRollupChain adds the series in the order from the finest to the coarsest,
+// e.g. 1m/1s, 1h/1m, 30d/1h. The first series receives the measures,
+// and each following series is built by merging the finished bins of the previous one.
+// The period of a series should be a multiple of the period of the previous one,
+// it panics otherwise. A series that has been added by WithSeries can be in a chain,
+// the series are reordered so that the source of a rollup comes before it.
+func WithRollupChain(chain ...SeriesID) CollectorOption {
+	for i := 1; i < len(chain); i++ {
+		if err := checkRollup(chain[i-1], chain[i]); err != nil {
+			panic(fmt.Sprintf("metric: WithRollupChain: %v", err))
+		}
+	}
+	return func(c *Collector) {
+		if c.rollups == nil {
+			c.rollups = make(map[string]string)
+		}
+		for i, ser := range chain {
+			if !slices.ContainsFunc(c.series, func(s SeriesID) bool { return s.ID() == ser.ID() }) {
+				c.series = append(c.series, ser)
+			}
+			if i > 0 {
+				c.rollups[ser.ID()] = chain[i-1].ID()
+			}
+		}
+	}
+}
+
+// checkRollup returns an error if the series cannot be rolled up from the source.
+func checkRollup(src, ser SeriesID) error {
+	if src.Period() <= 0 || ser.Period() <= src.Period() || ser.Period()%src.Period() != 0 {
+		return fmt.Errorf("period %s of %s is not a multiple of period %s of %s",
+			ser.Period(), ser.ID(), src.Period(), src.ID())
+	}
+	return nil
+}
+
+// sortRollupSources reorders the series so that the source of a rollup comes before it,
+// since the time series of a measure are added in the order and a rollup takes
+// the finished bins of its source. The other series keep their order.
+func (c *Collector) sortRollupSources() {
+	byID := make(map[string]SeriesID, len(c.series))
+	for _, ser := range c.series {
+		byID[ser.ID()] = ser
+	}
+	sorted := make([]SeriesID, 0, len(c.series))
+	placed := make(map[string]bool, len(c.series))
+	var place func(ser SeriesID)
+	place = func(ser SeriesID) {
+		if placed[ser.ID()] {
+			return
+		}
+		placed[ser.ID()] = true
+		if src, ok := c.rollups[ser.ID()]; ok {
+			place(byID[src])
+		}
+		sorted = append(sorted, ser)
+	}
+	for _, ser := range c.series {
+		place(ser)
+	}
+	c.series = sorted
+}
+
+// WithProcessors adds the processors that transform the measures
+// before the filter of WithTimeseriesFilter is applied.
+func WithProcessors(processors ...Processor) CollectorOption {
+	return func(c *Collector) {
+		c.processors = append(c.processors, processors...)
+	}
+}
+
+type computedMetric struct {
+	name string
+	expr *Expr
+	typ  Type
+}
+
+// WithComputed adds a metric whose value is evaluated on every sampling tick
+// from the values of other metrics gathered since the previous tick,
+// e.g. WithComputed("mem:used_percent", MustParseExpr("mem:used / mem:total * 100"), GaugeType(UnitPercent)).
+// The computed metric is stored in the time series like the gathered ones,
+// it is skipped in the tick if none of the referred metrics was gathered.
+func WithComputed(name string, expr *Expr, typ Type) CollectorOption {
+	return func(c *Collector) {
+		c.computed = append(c.computed, computedMetric{name: name, expr: expr, typ: typ})
+	}
+}
+
 func WithTimeseriesFilter(filter Filter) CollectorOption {
 	return func(c *Collector) {
 		c.timeseriesFilter = filter
 	}
 }
 
-// WithPrefix sets the prefix for all published expvar metrics.
+// WithPrefix sets the prefix for all published metrics.
 func WithPrefix(prefix string) CollectorOption {
 	return func(c *Collector) {
 		c.expvarPrefix = prefix
 	}
 }
 
+// WithRegistry sets the registry where the time series are published.
+// Default is an in-memory registry owned by the collector,
+// use NewExpvarRegistry() to publish the time series to expvar.
+func WithRegistry(r Registry) CollectorOption {
+	return func(c *Collector) {
+		c.registry = r
+	}
+}
+
+// WithInputTimeout sets the default timeout of gathering for each input.
+// An input that does not return in time is reported and skipped for the tick.
+// Default is 0, which means no timeout.
+func WithInputTimeout(timeout time.Duration) CollectorOption {
+	return func(c *Collector) {
+		c.inputTimeout = timeout
+	}
+}
+
 // WithInputBuffer sets the size of the input buffer channel.
 func WithInputBuffer(size int) CollectorOption {
 	return func(c *Collector) {
@@ -152,6 +349,61 @@ func WithInputBuffer(size int) CollectorOption {
 	}
 }
 
+// WithOverflowPolicy sets the policy when the input buffer is full.
+// It applies to Send() and the gatherings of the inputs, the sampling ticks always wait
+// and are never dropped to make room.
+// Default is OverflowBlock.
+func WithOverflowPolicy(policy OverflowPolicy) CollectorOption {
+	return func(c *Collector) {
+		c.overflow = policy
+	}
+}
+
+// WithOverflowSampleRate sets N of the OverflowSample policy,
+// one of every N gathers is kept while the input buffer is full. Default is 10.
+func WithOverflowSampleRate(n int) CollectorOption {
+	return func(c *Collector) {
+		c.sampler.rate = int64(n)
+	}
+}
+
+// WithMetricTTL sets the duration after which a time series that has not received
+// any measure is evicted from the collector and unpublished.
+// Default is 0, which means time series are never evicted.
+func WithMetricTTL(ttl time.Duration) CollectorOption {
+	return func(c *Collector) {
+		c.metricTTL = ttl
+	}
+}
+
+// CardinalityPolicy determines what happens when a new time series
+// exceeds the limit set by WithMaxMetrics.
+type CardinalityPolicy int
+
+const (
+	// CardinalityDropNew drops the measures of the new time series.
+	CardinalityDropNew CardinalityPolicy = iota
+	// CardinalityEvictIdle evicts the time series that has been idle for the longest time.
+	CardinalityEvictIdle
+)
+
+// WithMaxMetrics limits the number of time series in the collector.
+// Default is 0, which means no limit.
+func WithMaxMetrics(max int, policy CardinalityPolicy) CollectorOption {
+	return func(c *Collector) {
+		c.maxMetrics = max
+		c.cardinalityPolicy = policy
+	}
+}
+
+// WithClock sets the clock of the collector and its time series.
+// Default is SystemClock(), use FakeClock to run the collector in virtual time.
+func WithClock(clock Clock) CollectorOption {
+	return func(c *Collector) {
+		c.clock = clock
+	}
+}
+
 func WithStorage(store Storage) CollectorOption {
 	return func(c *Collector) {
 		c.storage = store
@@ -187,6 +439,20 @@ func (fi *FilterInput) Gather(g *Gather) error {
 	return nil
 }
 
+func (fi *FilterInput) GatherContext(ctx context.Context, g *Gather) error {
+	var err error
+	if ci, ok := fi.Input.(ContextInput); ok {
+		err = ci.GatherContext(ctx, g)
+	} else {
+		err = fi.Input.Gather(g)
+	}
+	if err != nil {
+		return err
+	}
+	g.Filter(fi.Filter)
+	return nil
+}
+
 func (fi *FilterInput) DeInit() {
 	if hasDeInit, ok := fi.Input.(interface{ DeInit() }); ok {
 		hasDeInit.DeInit()
@@ -233,6 +499,11 @@ func (me MultipleError) Error() string {
 	return sb.String()
 }
 
+// Unwrap returns the errors, so that errors.Is and errors.As look into each of them.
+func (me MultipleError) Unwrap() []error {
+	return me
+}
+
 func (c *Collector) AddOutput(outputs ...Output) error {
 	var errs MultipleError
 	c.Lock()
@@ -263,14 +534,29 @@ func (ow *OutputFuncWrapper) Process(p Product) error {
 // AddOutputFunc adds an output function to the collector.
 // The output function will be called with the collected Product.
 func (c *Collector) AddOutputFunc(output OutputFunc) {
+	c.Lock()
+	defer c.Unlock()
 	c.outputs = append(c.outputs, &OutputFuncWrapper{output})
 }
 
 func (c *Collector) AddInput(inputs ...Input) error {
+	entries := make([]*inputEntry, len(inputs))
+	for i, input := range inputs {
+		entries[i] = newInputEntry(input, c.inputTimeout)
+	}
+	return c.addInputs(entries...)
+}
+
+// AddInputWithOptions adds an input with the per-input options.
+func (c *Collector) AddInputWithOptions(input Input, opts ...InputOption) error {
+	return c.addInputs(newInputEntry(input, c.inputTimeout, opts...))
+}
+
+func (c *Collector) addInputs(entries ...*inputEntry) error {
 	var errs MultipleError
 	var initialGathers []*Gather
 	c.Lock()
-	ts := nowFunc()
+	ts := c.clock.Now()
 	defer func() {
 		c.Unlock()
 		for _, g := range initialGathers {
@@ -278,21 +564,30 @@ func (c *Collector) AddInput(inputs ...Input) error {
 			c.receive(g)
 		}
 	}()
-	for _, input := range inputs {
-		if hasInit, ok := input.(interface{ Init() error }); ok {
+	for _, in := range entries {
+		in.added = ts
+		if hasInit, ok := in.input.(interface{ Init() error }); ok {
 			if err := hasInit.Init(); err != nil {
 				errs = append(errs, err)
 				continue
 			}
 		}
-		// the first call to get the measurement name
-		g := &Gather{}
-		if err := input.Gather(g); err != nil {
-			errs = append(errs, err)
-			continue
+		// the first call to get the measurement name,
+		// unless the input wants to be delayed
+		if in.initialDelay <= 0 {
+			g, err := in.gather(c.ctx)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			g.input = in.name
+			in.lastSeen.Store(&ts)
+			initialGathers = append(initialGathers, g)
+		}
+		c.inputs = append(c.inputs, in)
+		if c.started && !c.stopped && in.scheduled() {
+			go c.runSchedule(in)
 		}
-		initialGathers = append(initialGathers, g)
-		c.inputs = append(c.inputs, input)
 	}
 	if len(errs) > 0 {
 		return errs
@@ -308,20 +603,57 @@ func (iw *InputFuncWrapper) Gather(g *Gather) error {
 	return iw.f(g)
 }
 
+// AddProcessor adds the processors, it can be called while the collector is running.
+func (c *Collector) AddProcessor(processors ...Processor) {
+	c.Lock()
+	defer c.Unlock()
+	c.processors = append(c.processors, processors...)
+}
+
+// AddComputed parses the expression and adds the computed metric, see WithComputed.
+// It can be called while the collector is running.
+func (c *Collector) AddComputed(name string, expr string, typ Type) error {
+	e, err := ParseExpr(expr)
+	if err != nil {
+		return err
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.computed = append(c.computed, computedMetric{name: name, expr: e, typ: typ})
+	return nil
+}
+
 // AddInputFunc adds an input function to the collector.
 func (c *Collector) AddInputFunc(input InputFunc) error {
 	return c.AddInput(&InputFuncWrapper{f: input})
 }
 
+// Start starts the sampling loop of the collector.
+// It does nothing if the collector has been started or stopped already.
 func (c *Collector) Start() {
-	ticker := time.NewTicker(c.samplingInterval)
+	c.Lock()
+	if c.started || c.stopped {
+		c.Unlock()
+		return
+	}
+	c.started = true
+	for _, in := range c.inputs {
+		if in.scheduled() {
+			go c.runSchedule(in)
+		}
+	}
+	c.Unlock()
+
+	ticker := c.clock.NewTicker(c.samplingInterval)
 	c.stopWg.Add(1)
 	go func() {
 		defer c.stopWg.Done()
 		for {
 			select {
-			case ts := <-ticker.C:
-				go c.runInputs(ts)
+			case ts := <-ticker.C():
+				if !c.paused.Load() {
+					go c.runInputs(ts)
+				}
 			case m := <-c.recvCh:
 				c.receive(m)
 			case <-c.closeCh:
@@ -340,24 +672,172 @@ func (c *Collector) Start() {
 	}()
 }
 
+// Stop stops the collector and waits until the shutdown completes, see Shutdown.
 func (c *Collector) Stop() {
-	close(c.closeCh)
+	c.Shutdown(context.Background())
+}
+
+// Shutdown stops the collector: it cancels the running inputs, drains the buffered gathers,
+// stores the last bins to the storage, and then calls DeInit() of the inputs and outputs.
+// An input that is still gathering is waited for up to its timeout, or the sampling interval
+// if it has no timeout, and its DeInit() is called when the gathering returns.
+// If ctx is done before the shutdown completes, it returns the error of ctx
+// while the shutdown goes on in the background.
+// It is safe to call Shutdown and Stop more than once, the later calls wait for the first one.
+func (c *Collector) Shutdown(ctx context.Context) error {
+	c.stopOnce.Do(func() {
+		c.Lock()
+		c.stopped = true
+		c.Unlock()
+		// cancel the running inputs
+		c.cancel()
+		close(c.closeCh)
+		go c.shutdown()
+	})
+	select {
+	case <-c.doneCh:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Collector) shutdown() {
+	defer close(c.doneCh)
 	c.stopWg.Wait()
 	c.syncStorage()
-	// call DeInit() of inputs if exists
-	for _, input := range c.inputs {
-		if hasDeInit, ok := input.(interface{ DeInit() error }); ok {
-			hasDeInit.DeInit()
-		}
+
+	c.Lock()
+	inputs := slices.Clone(c.inputs)
+	outputs := slices.Clone(c.outputs)
+	c.Unlock()
+	// call DeInit() of inputs if exists, the inputs stuck in gathering
+	// are waited for a while together, and DeInit() later when they return
+	var wg sync.WaitGroup
+	for _, in := range inputs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := in.remove(c.removeWait(in)); err != nil {
+				slog.Warn("Input is still gathering on shutdown", "input", in.name, "error", err)
+			}
+		}()
 	}
+	wg.Wait()
 	// call DeInit() of outputs if exists
+	for _, out := range outputs {
+		deInit(out)
+	}
+}
+
+// Pause stops the sampling of the inputs and the rolling of the time series
+// until Resume is called. The inputs, outputs and storage are kept,
+// and the measures sent by Send are still received.
+func (c *Collector) Pause() {
+	c.paused.Store(true)
+}
+
+// Resume resumes the sampling paused by Pause.
+func (c *Collector) Resume() {
+	c.paused.Store(false)
+}
+
+// Paused reports whether the collector is paused.
+func (c *Collector) Paused() bool {
+	return c.paused.Load()
+}
+
+// RemoveInput removes the input that has been added by AddInput or AddInputWithOptions.
+// It can be called while the collector is running; the schedule of the input is stopped,
+// and DeInit() of the input is called after its in-flight gathering returns.
+// It waits for the gathering up to the timeout of the input, or the sampling interval
+// if the input has no timeout, and returns ErrInputTimeout if the gathering is still running,
+// the input is removed anyway and DeInit() is called when the gathering returns.
+func (c *Collector) RemoveInput(input Input) error {
+	return c.removeInputs(func(in *inputEntry) bool { return sameHandle(in.input, input) })
+}
+
+// RemoveInputByName removes all inputs that have the name.
+// The name is the one set by InputName, or the Name() method of the input
+// if exists, otherwise the type name of the input.
+func (c *Collector) RemoveInputByName(name string) error {
+	return c.removeInputs(func(in *inputEntry) bool { return in.name == name })
+}
+
+func (c *Collector) removeInputs(match func(*inputEntry) bool) error {
+	var removed []*inputEntry
+	c.Lock()
+	inputs := c.inputs[:0]
+	for _, in := range c.inputs {
+		if match(in) {
+			removed = append(removed, in)
+		} else {
+			inputs = append(inputs, in)
+		}
+	}
+	clear(c.inputs[len(inputs):])
+	c.inputs = inputs
+	c.Unlock()
+
+	if len(removed) == 0 {
+		return ErrInputNotFound
+	}
+	// DeInit() outside of the lock, so that the collector loop keeps going
+	var errs MultipleError
+	for _, in := range removed {
+		if err := in.remove(c.removeWait(in)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// removeWait returns how long the removal of the input waits for its in-flight gathering,
+// which is the timeout of the input, or the sampling interval if the input has no timeout.
+func (c *Collector) removeWait(in *inputEntry) time.Duration {
+	if in.timeout > 0 {
+		return in.timeout
+	}
+	return c.samplingInterval
+}
+
+// RemoveOutput removes the output and calls its DeInit() if exists.
+// It can be called while the collector is running, the output does not
+// receive any Product after RemoveOutput returns.
+func (c *Collector) RemoveOutput(output Output) error {
+	return c.removeOutputs(func(out Output) bool { return sameHandle(out, output) })
+}
+
+// RemoveOutputByName removes all outputs that have the name.
+// The name is the Name() method of the output if exists, otherwise the type name of the output.
+func (c *Collector) RemoveOutputByName(name string) error {
+	return c.removeOutputs(func(out Output) bool { return pluginName(out) == name })
+}
+
+func (c *Collector) removeOutputs(match func(Output) bool) error {
+	var removed []Output
+	c.Lock()
+	outputs := make([]Output, 0, len(c.outputs))
 	for _, out := range c.outputs {
-		if hasDeInit, ok := out.(interface{ DeInit() }); ok {
-			hasDeInit.DeInit()
+		if match(out) {
+			removed = append(removed, out)
+		} else {
+			outputs = append(outputs, out)
 		}
 	}
-	// close at the end to avoid sending to closed channel
-	close(c.recvCh)
+	c.outputs = outputs
+	c.Unlock()
+
+	if len(removed) == 0 {
+		return ErrOutputNotFound
+	}
+	for _, out := range removed {
+		deInit(out)
+	}
+	return nil
 }
 
 func (c *Collector) makePublishName(metricName string) string {
@@ -369,34 +849,155 @@ func (c *Collector) makePublishName(metricName string) string {
 }
 
 // Send processes a measurement sent to the collector.
+// If the input buffer is full, the overflow policy set by WithOverflowPolicy applies.
 func (c *Collector) Send(measurements ...Measure) {
 	g := &Gather{
 		measures: measurements,
-		ts:       nowFunc(),
+		ts:       c.clock.Now(),
+	}
+	c.send(g, c.overflow)
+}
+
+// TrySend is like Send but never waits for the collector.
+// If the input buffer is full, OverflowBlock is taken as OverflowDropNewest.
+// It returns false if the measurements are dropped.
+func (c *Collector) TrySend(measurements ...Measure) bool {
+	g := &Gather{
+		measures: measurements,
+		ts:       c.clock.Now(),
+	}
+	policy := c.overflow
+	if policy == OverflowBlock {
+		policy = OverflowDropNewest
+	}
+	return c.send(g, policy)
+}
+
+// DroppedGathers returns the number of gathers dropped by the overflow policy,
+// including the ones sent after the collector is stopped.
+func (c *Collector) DroppedGathers() int64 {
+	return c.dropped.Load()
+}
+
+// send delivers the gather to the collector loop according to the policy.
+// It gives up if the collector is stopped, recvCh is never closed
+// so that the senders racing with Stop() do not panic.
+func (c *Collector) send(g *Gather, policy OverflowPolicy) bool {
+	if c.ctx.Err() != nil {
+		c.dropped.Add(1)
+		return false
+	}
+	ok, dropped := enqueue(c.recvCh, g, policy, &c.sampler, isNoopGather, c.ctx.Done())
+	if dropped > 0 {
+		c.dropped.Add(int64(dropped))
 	}
-	c.recvCh <- g
+	return ok
+}
+
+// isNoopGather reports whether the gather is a sampling tick, which is never dropped.
+func isNoopGather(g *Gather) bool {
+	return g.noop
 }
 
 func (c *Collector) runInputs(ts time.Time) {
-	// there are chances that recvCh is already closed
-	// because of Stop() has been called.
-	// so we need to recover from panic.
+	// inputs are user code, do not let a panic kill the process.
 	defer func() {
 		if r := recover(); r != nil {
 			slog.Error("Recovered in runInputs", "error", r)
 		}
 	}()
 
-	for _, input := range c.inputs {
-		gather := &Gather{}
-		if err := input.Gather(gather); err != nil {
-			slog.Error("Error gathering metrics", "error", err)
+	c.Lock()
+	inputs := make([]*inputEntry, 0, len(c.inputs))
+	for _, in := range c.inputs {
+		// the inputs that have their own schedule are gathered by runSchedule()
+		if !in.scheduled() {
+			inputs = append(inputs, in)
+		}
+	}
+	c.Unlock()
+
+	for _, in := range inputs {
+		if !c.runInput(in, ts) {
+			return
+		}
+	}
+	// the noop tick rolls all time series at the collector's interval,
+	// regardless of the schedule of each input.
+	c.send(&Gather{noop: true, ts: ts}, OverflowBlock)
+}
+
+// runInput gathers the input and sends the result to the collector loop.
+// It returns false if the collector is stopped.
+func (c *Collector) runInput(in *inputEntry, ts time.Time) bool {
+	gather, err := in.gather(c.ctx)
+	if err != nil {
+		if errors.Is(err, ErrInputRemoved) {
+			return c.ctx.Err() == nil
+		} else if errors.Is(err, ErrInputTimeout) || errors.Is(err, ErrInputBusy) {
+			slog.Warn("Input timed out", "input", in.name, "error", err)
+		} else if !errors.Is(err, context.Canceled) {
+			slog.Error("Error gathering metrics", "input", in.name, "error", err)
+		}
+		return c.ctx.Err() == nil
+	}
+	gather.ts = ts
+	gather.input = in.name
+	in.lastSeen.Store(&ts)
+	c.send(gather, c.overflow)
+	return c.ctx.Err() == nil
+}
+
+// runSchedule gathers the input periodically on its own interval until the collector stops.
+func (c *Collector) runSchedule(in *inputEntry) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("Recovered in runSchedule", "input", in.name, "error", r)
+		}
+	}()
+
+	interval := in.interval
+	if interval <= 0 {
+		interval = c.samplingInterval
+	}
+	if in.initialDelay > 0 {
+		select {
+		case <-c.clock.After(in.initialDelay):
+		case <-c.closeCh:
+			return
+		case <-in.stopCh:
+			return
+		}
+		if !c.paused.Load() && !c.runInput(in, c.clock.Now()) {
+			return
+		}
+	}
+	ticker := c.clock.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+		case <-c.closeCh:
+			return
+		case <-in.stopCh:
+			return
+		}
+		if c.paused.Load() {
 			continue
 		}
-		gather.ts = ts
-		c.recvCh <- gather
+		if jitter := in.nextJitter(); jitter > 0 {
+			select {
+			case <-c.clock.After(jitter):
+			case <-c.closeCh:
+				return
+			case <-in.stopCh:
+				return
+			}
+		}
+		if !c.runInput(in, c.clock.Now()) {
+			return
+		}
 	}
-	c.recvCh <- &Gather{noop: true, ts: ts}
 }
 
 func (c *Collector) receive(m *Gather) {
@@ -404,38 +1005,164 @@ func (c *Collector) receive(m *Gather) {
 	defer c.Unlock()
 
 	if m.ts.IsZero() {
-		m.ts = nowFunc()
+		m.ts = c.clock.Now()
 	}
 
 	if m.noop {
+		c.evalComputed(m.ts)
 		nan := math.NaN()
 		for _, mts := range c.timeseries {
 			for _, ts := range mts {
 				ts.AddTime(m.ts, nan)
 			}
 		}
+		c.evictIdle(m.ts)
+		c.detectAbsence(m.ts)
 		return
 	}
 
-	for _, measure := range m.measures {
+	measures := m.measures
+	if len(c.processors) > 0 {
+		// the measures of Send() are of the caller, which may reuse the slice
+		measures = slices.Clone(measures)
+	}
+	for _, p := range c.processors {
+		measures = p.Apply(measures)
+	}
+	for _, measure := range measures {
 		if c.timeseriesFilter != nil && !c.timeseriesFilter.Match(measure.Name) {
 			continue
 		}
-		var mts MultiTimeSeries
-		if fm, exists := c.timeseries[measure.Name]; exists {
-			mts = fm
+		c.addMeasure(measure, m.input, m.ts)
+	}
+}
+
+// addMeasure adds the measure to its time series, which is created if not exists.
+// The caller should hold the lock.
+func (c *Collector) addMeasure(measure Measure, input string, tm time.Time) {
+	key := measure.Key()
+	var mts MultiTimeSeries
+	if fm, exists := c.timeseries[key]; exists {
+		mts = fm
+	} else {
+		if !c.admit() {
+			c.rejected.Add(1)
+			return
+		}
+		mts = c.makeMultiTimeSeries(measure)
+		c.timeseries[key] = mts
+		c.registry.Publish(c.makePublishName(key), mts)
+	}
+	c.seen(key, input, tm)
+	if !measure.Hashed && !c.isComputed(key) {
+		if v, ok := c.lastValues[key]; ok && measure.Type.Name() == "counter" {
+			// a counter of the tick is the sum as its bin
+			c.lastValues[key] = v + measure.Value
 		} else {
-			mts = c.makeMultiTimeSeries(measure)
-			c.timeseries[measure.Name] = mts
-			publishName := c.makePublishName(measure.Name)
-			expvar.Publish(publishName, mts)
+			c.lastValues[key] = measure.Value
 		}
-		mts.AddTime(m.ts, measure.Value)
 	}
+	for i, ts := range mts {
+		if _, ok := c.rollups[c.series[i].ID()]; ok {
+			// a rollup series takes the bins of its source, only the time moves
+			ts.AddTime(tm, math.NaN())
+		} else if measure.Hashed {
+			if err := ts.AddHashTime(tm, measure.Hash); err != nil {
+				slog.Error("Error adding key to time series", "name", key, "error", err)
+			}
+		} else {
+			ts.AddTime(tm, measure.Value)
+		}
+	}
+}
+
+// evalComputed adds the values of the computed metrics evaluated from the values
+// gathered since the previous tick, which are cleared after that.
+// A computed metric can refer to the computed metrics defined before it,
+// the aggregate functions take the gathered values only, so that e.g. "cpu:total" of "sum(cpu:*)"
+// does not add itself.
+func (c *Collector) evalComputed(tm time.Time) {
+	computed := make(map[string]float64, len(c.computed))
+	for _, cm := range c.computed {
+		v := cm.expr.evalComputed(c.lastValues, computed)
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		computed[cm.name] = v
+		c.addMeasure(Measure{Name: cm.name, Value: v, Type: cm.typ}, "", tm)
+	}
+	clear(c.lastValues)
+}
+
+// isComputed reports whether the series key is of a computed metric.
+func (c *Collector) isComputed(key string) bool {
+	for _, cm := range c.computed {
+		if cm.name == key {
+			return true
+		}
+	}
+	return false
+}
+
+// admit reports whether a new time series can be added under the limit of WithMaxMetrics.
+// With CardinalityEvictIdle, it evicts the least recently seen time series to make room.
+func (c *Collector) admit() bool {
+	if c.maxMetrics <= 0 || len(c.timeseries) < c.maxMetrics {
+		return true
+	}
+	if c.cardinalityPolicy != CardinalityEvictIdle {
+		return false
+	}
+	var oldestKey string
+	var oldest time.Time
+	for key, seen := range c.lastSeen {
+		if oldestKey == "" || seen.Before(oldest) {
+			oldestKey, oldest = key, seen
+		}
+	}
+	if oldestKey == "" {
+		return false
+	}
+	c.evict(oldestKey)
+	return true
+}
+
+// evictIdle evicts the time series that have not received any measure within the TTL.
+func (c *Collector) evictIdle(now time.Time) {
+	if c.metricTTL <= 0 {
+		return
+	}
+	for key, seen := range c.lastSeen {
+		if now.Sub(seen) > c.metricTTL {
+			c.evict(key)
+		}
+	}
+}
+
+// evict removes the time series, the caller should hold the lock.
+func (c *Collector) evict(key string) {
+	delete(c.timeseries, key)
+	delete(c.lastSeen, key)
+	delete(c.lastValues, key)
+	delete(c.lastInputs, key)
+	delete(c.absent, key)
+	c.registry.Unpublish(c.makePublishName(key))
+	c.evicted.Add(1)
+}
+
+// RejectedMetrics returns the number of measures dropped by the limit of WithMaxMetrics.
+func (c *Collector) RejectedMetrics() int64 {
+	return c.rejected.Load()
+}
+
+// EvictedMetrics returns the number of time series evicted by the TTL or the limit.
+func (c *Collector) EvictedMetrics() int64 {
+	return c.evicted.Load()
 }
 
 type Product struct {
 	Name        string        `json:"name"`
+	Labels      Labels        `json:"labels,omitempty"`
 	Time        time.Time     `json:"ts"`
 	Value       Value         `json:"value,omitempty"`
 	IsNull      bool          `json:"isNull,omitempty"`
@@ -446,6 +1173,11 @@ type Product struct {
 	Unit        Unit          `json:"unit,omitempty"`
 }
 
+// Key returns the key of the time series that produced the Product.
+func (p Product) Key() string {
+	return SeriesKey(p.Name, p.Labels)
+}
+
 func (p Product) String() string {
 	b, err := json.Marshal(p)
 	if err != nil {
@@ -477,16 +1209,19 @@ func (c *Collector) makeMultiTimeSeries(measure Measure) MultiTimeSeries {
 	mts := make(MultiTimeSeries, len(c.series))
 	for i, ser := range c.series {
 		var ts = NewTimeSeries(ser.Period(), ser.MaxCount(), measure.Type.Producer(),
-			WithListener(c.onProduct),
+			WithListener(c.rollupListener(mts, i)),
+			WithTimeSeriesClock(c.clock),
+			WithTimeSeriesDerivers(measure.Type.Derivers()...),
 			WithMeta(SeriesInfo{
 				MeasureName: measure.Name,
+				Labels:      measure.Labels.Copy(),
 				MeasureType: measure.Type,
 				SeriesID:    ser,
 			}),
 		)
 		if c.storage != nil {
-			if err := ts.Restore(c.storage, measure.Name, ser); err != nil {
-				slog.Error("Failed to restore time series", "measure", measure.Name, "series", ser.ID(), "error", err)
+			if err := ts.Restore(c.storage, measure.Key(), ser); err != nil {
+				slog.Error("Failed to restore time series", "measure", measure.Key(), "series", ser.ID(), "error", err)
 			}
 		}
 		mts[i] = ts
@@ -494,6 +1229,53 @@ func (c *Collector) makeMultiTimeSeries(measure Measure) MultiTimeSeries {
 	return mts
 }
 
+// rollupListener returns the listener of the i-th time series of mts,
+// which feeds the finished bins into the rollup series of which the i-th is the source.
+// The rollup series are created after the listener is made, so mts is looked up lazily.
+func (c *Collector) rollupListener(mts MultiTimeSeries, i int) func(Product) {
+	var targets []int
+	for j, ser := range c.series {
+		if src, ok := c.rollups[ser.ID()]; ok && src == c.series[i].ID() {
+			targets = append(targets, j)
+		}
+	}
+	if len(targets) == 0 {
+		return c.onProduct
+	}
+	period := c.series[i].Period()
+	return func(prd Product) {
+		c.onProduct(prd)
+		// the time of the Product is the end of the bin
+		start := prd.Time.Add(-period)
+		for _, j := range targets {
+			if err := mts[j].AddValue(start, prd.Value); err != nil {
+				slog.Error("Error rolling up time series", "name", prd.Key(), "series", c.series[j].ID(), "error", err)
+			}
+		}
+	}
+}
+
+// InputStatus returns the status of all registered inputs.
+func (c *Collector) InputStatus() []InputStatus {
+	c.Lock()
+	defer c.Unlock()
+	ret := make([]InputStatus, len(c.inputs))
+	for i, in := range c.inputs {
+		ret[i] = in.status()
+	}
+	return ret
+}
+
+// Storage returns the storage set by WithStorage, or nil.
+func (c *Collector) Storage() Storage {
+	return c.storage
+}
+
+// Registry returns the registry where the time series are published.
+func (c *Collector) Registry() Registry {
+	return c.registry
+}
+
 func (c *Collector) SamplingInterval() time.Duration {
 	return c.samplingInterval
 }
@@ -513,6 +1295,9 @@ func (c *Collector) PublishNames() []string {
 	return names
 }
 
+// MetricNames returns the keys of all time series in the collector.
+// The key of a labeled series is the measure name followed by its labels,
+// e.g. `disk:used_percent{path="/mnt/c"}`.
 func (c *Collector) MetricNames() []string {
 	c.Lock()
 	defer c.Unlock()
@@ -523,7 +1308,7 @@ func (c *Collector) MetricNames() []string {
 	return names
 }
 
-// Timeseries returns the MultiTimeSeries for the specified measurement name.
+// Timeseries returns the MultiTimeSeries for the specified series key.
 // If the measurement does not exist, it returns nil.
 func (c *Collector) Timeseries(name string) MultiTimeSeries {
 	c.Lock()
@@ -531,6 +1316,42 @@ func (c *Collector) Timeseries(name string) MultiTimeSeries {
 	return c.timeseries[name]
 }
 
+// Select returns the sorted keys of the time series of the measure name
+// whose labels contain all of the given labels.
+// If match is empty, all series of the measure are returned.
+func (c *Collector) Select(name string, match Labels) []string {
+	c.Lock()
+	defer c.Unlock()
+	var keys []string
+	for key, mts := range c.timeseries {
+		if splitSeriesKey(key) != name {
+			continue
+		}
+		if nfo, ok := mts.info(); ok && !nfo.Labels.Match(match) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// GroupBy groups the time series of the measure name by the value of the label.
+// The key of the returned map is the label value, and the value is the sorted
+// series keys that have the label value.
+// Series that do not have the label are grouped under an empty string.
+func (c *Collector) GroupBy(name string, label string) map[string][]string {
+	ret := map[string][]string{}
+	for _, key := range c.Select(name, nil) {
+		var value string
+		if nfo, ok := c.Timeseries(key).info(); ok {
+			value = nfo.Labels[label]
+		}
+		ret[value] = append(ret[value], key)
+	}
+	return ret
+}
+
 func (c *Collector) Series() []SeriesID {
 	c.Lock()
 	defer c.Unlock()
@@ -539,12 +1360,12 @@ func (c *Collector) Series() []SeriesID {
 	return ret
 }
 
-// Inflight returns the current collecting data for each series of the specified measurement.
+// Inflight returns the current collecting data for each series of the specified series key.
 // The key of the returned map is the series id.
 // If the measurement does not exist, it returns ErrMetricNotFound.
 func (c *Collector) Inflight(measureName string) (map[string]Product, error) {
 	var mts MultiTimeSeries
-	if m, ok := c.timeseries[measureName]; !ok {
+	if m := c.Timeseries(measureName); m == nil {
 		return nil, ErrMetricNotFound
 	} else {
 		mts = m
@@ -561,6 +1382,7 @@ func (c *Collector) Inflight(measureName string) (map[string]Product, error) {
 		ts, prd := mts[idx].Last()
 		ret[seriesID] = Product{
 			Name:        nfo.MeasureName,
+			Labels:      nfo.Labels,
 			Time:        ts,
 			Value:       prd,
 			IsNull:      prd == nil,
@@ -597,3 +1419,4 @@ func (c *Collector) syncStorage() {
 }
 
 var ErrMetricNotFound = errors.New("metric not found")
+var ErrOutputNotFound = errors.New("output not found")
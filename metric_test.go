@@ -1,6 +1,7 @@
 package metric
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"testing"
@@ -9,11 +10,6 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func TestMain(m *testing.M) {
-	timeZone = time.UTC
-	m.Run()
-}
-
 func TestMetric(t *testing.T) {
 	var wg sync.WaitGroup
 	var out string
@@ -58,3 +54,494 @@ func TestMetric(t *testing.T) {
 	require.Equal(t, "counter", pd.Type)
 	c.Stop()
 }
+
+func TestCollectorLabels(t *testing.T) {
+	seriesID, err := NewSeriesID("LABELS_1M", "1m/1s", time.Second, 60)
+	require.NoError(t, err)
+	c := NewCollector(
+		WithSamplingInterval(time.Second),
+		WithSeries(seriesID),
+	)
+	err = c.AddInputFunc(func(g *Gather) error {
+		g.AddWithLabels("disk:used_percent", Labels{"path": "/", "host": "a"}, 10, GaugeType(UnitPercent))
+		g.AddWithLabels("disk:used_percent", Labels{"path": "/mnt/c", "host": "a"}, 20, GaugeType(UnitPercent))
+		g.AddWithLabels("disk:used_percent", Labels{"path": "/", "host": "b"}, 30, GaugeType(UnitPercent))
+		g.Add("cpu:percent", 40, GaugeType(UnitPercent))
+		return nil
+	})
+	require.NoError(t, err)
+
+	names := c.MetricNames()
+	require.ElementsMatch(t, []string{
+		`cpu:percent`,
+		`disk:used_percent{host="a",path="/"}`,
+		`disk:used_percent{host="a",path="/mnt/c"}`,
+		`disk:used_percent{host="b",path="/"}`,
+	}, names)
+
+	require.Equal(t, []string{
+		`disk:used_percent{host="a",path="/"}`,
+		`disk:used_percent{host="a",path="/mnt/c"}`,
+	}, c.Select("disk:used_percent", Labels{"host": "a"}))
+	require.Len(t, c.Select("disk:used_percent", nil), 3)
+	require.Equal(t, []string{"cpu:percent"}, c.Select("cpu:percent", nil))
+
+	groups := c.GroupBy("disk:used_percent", "path")
+	require.Equal(t, map[string][]string{
+		"/":      {`disk:used_percent{host="a",path="/"}`, `disk:used_percent{host="b",path="/"}`},
+		"/mnt/c": {`disk:used_percent{host="a",path="/mnt/c"}`},
+	}, groups)
+
+	sn, err := c.Inflight(`disk:used_percent{host="b",path="/"}`)
+	require.NoError(t, err)
+	pd := sn["LABELS_1M"]
+	require.Equal(t, "disk:used_percent", pd.Name)
+	require.Equal(t, Labels{"host": "b", "path": "/"}, pd.Labels)
+	require.Equal(t, 30.0, pd.Value.(*GaugeValue).Value)
+}
+
+func TestCollectorOverflow(t *testing.T) {
+	// the collector is not started, so nothing consumes the input buffer
+	c := NewCollector(WithInputBuffer(2))
+	require.True(t, c.TrySend(Measure{Name: "m1", Value: 1, Type: CounterType(UnitShort)}))
+	require.True(t, c.TrySend(Measure{Name: "m2", Value: 1, Type: CounterType(UnitShort)}))
+	require.False(t, c.TrySend(Measure{Name: "m3", Value: 1, Type: CounterType(UnitShort)}))
+	require.Equal(t, int64(1), c.DroppedGathers())
+	c.Stop()
+
+	c = NewCollector(WithInputBuffer(2), WithOverflowPolicy(OverflowDropOldest))
+	for i := range 5 {
+		c.Send(Measure{Name: fmt.Sprintf("m%d", i), Value: 1, Type: CounterType(UnitShort)})
+	}
+	require.Equal(t, int64(3), c.DroppedGathers())
+	require.Equal(t, "m3", (<-c.recvCh).measures[0].Name)
+	require.Equal(t, "m4", (<-c.recvCh).measures[0].Name)
+	c.Stop()
+
+	c = NewCollector(WithInputBuffer(1), WithOverflowPolicy(OverflowSample), WithOverflowSampleRate(2))
+	for i := range 5 {
+		c.Send(Measure{Name: fmt.Sprintf("m%d", i), Value: 1, Type: CounterType(UnitShort)})
+	}
+	// m0 fills the buffer, then every 2nd of m1..m4 replaces it
+	require.Equal(t, int64(4), c.DroppedGathers())
+	require.Equal(t, "m4", (<-c.recvCh).measures[0].Name)
+	c.Stop()
+
+	// after stop, nothing is accepted
+	require.False(t, c.TrySend(Measure{Name: "m5", Value: 1, Type: CounterType(UnitShort)}))
+	require.Equal(t, int64(5), c.DroppedGathers())
+}
+
+func TestCollectorOverflowTick(t *testing.T) {
+	seriesID, err := NewSeriesID("SEC", "1m/1s", time.Second, 60)
+	require.NoError(t, err)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	fc := NewFakeClock(start)
+	// the collector is not started, so nothing consumes the input buffer
+	c := NewCollector(WithSeries(seriesID), WithClock(fc),
+		WithInputBuffer(2), WithOverflowPolicy(OverflowDropOldest))
+	defer c.Stop()
+	var products []Product
+	c.AddOutputFunc(func(p Product) error {
+		products = append(products, p)
+		return nil
+	})
+	c.receive(&Gather{ts: start, measures: []Measure{{Name: "m", Value: 1, Type: GaugeType(UnitShort)}}})
+
+	fc.Advance(time.Second)
+	c.send(&Gather{noop: true, ts: fc.Now()}, OverflowBlock)
+	for i := range 3 {
+		c.Send(Measure{Name: "m", Value: float64(i + 2), Type: GaugeType(UnitShort)})
+	}
+	require.Equal(t, int64(2), c.DroppedGathers())
+	require.Len(t, c.recvCh, 2)
+	// the tick keeps its place before the newer gathers
+	tick := <-c.recvCh
+	require.True(t, tick.noop)
+	c.receive(tick)
+	for len(c.recvCh) > 0 {
+		c.receive(<-c.recvCh)
+	}
+	require.Len(t, products, 1)
+	require.Equal(t, start.Add(time.Second), products[0].Time)
+	require.Equal(t, 1.0, products[0].Value.(*GaugeValue).Value)
+
+	// a buffer full of ticks drops the others, and the ticks stay in order
+	c.send(&Gather{noop: true, ts: fc.Now()}, OverflowBlock)
+	c.send(&Gather{noop: true, ts: fc.Now().Add(time.Second)}, OverflowBlock)
+	require.False(t, c.TrySend(Measure{Name: "m", Value: 1, Type: GaugeType(UnitShort)}))
+	require.Equal(t, int64(3), c.DroppedGathers())
+	require.Equal(t, fc.Now(), (<-c.recvCh).ts)
+	require.Equal(t, fc.Now().Add(time.Second), (<-c.recvCh).ts)
+}
+
+func TestCollectorEviction(t *testing.T) {
+	seriesID, err := NewSeriesID("EVICT_1M", "1m/1s", time.Second, 60)
+	require.NoError(t, err)
+	c := NewCollector(
+		WithSeries(seriesID),
+		WithPrefix("evict"),
+		WithMetricTTL(5*time.Second),
+	)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.receive(&Gather{ts: now, measures: []Measure{
+		{Name: "user:a", Value: 1, Type: CounterType(UnitShort)},
+		{Name: "user:b", Value: 1, Type: CounterType(UnitShort)},
+	}})
+	c.receive(&Gather{ts: now.Add(4 * time.Second), measures: []Measure{
+		{Name: "user:b", Value: 1, Type: CounterType(UnitShort)},
+	}})
+	c.receive(&Gather{ts: now.Add(6 * time.Second), noop: true})
+	require.Equal(t, []string{"user:b"}, c.MetricNames())
+	require.Equal(t, int64(1), c.EvictedMetrics())
+	require.Nil(t, c.Registry().Get("evict:user:a"))
+	require.NotNil(t, c.Registry().Get("evict:user:b"))
+
+	// the evicted series is created again
+	c.receive(&Gather{ts: now.Add(7 * time.Second), measures: []Measure{
+		{Name: "user:a", Value: 1, Type: CounterType(UnitShort)},
+	}})
+	require.ElementsMatch(t, []string{"user:a", "user:b"}, c.MetricNames())
+	require.NotNil(t, c.Registry().Get("evict:user:a"))
+	c.Stop()
+}
+
+func TestCollectorFakeClock(t *testing.T) {
+	seriesID, err := NewSeriesID("CLOCK_1M", "1m/1s", time.Second, 60)
+	require.NoError(t, err)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	fc := NewFakeClock(start)
+	c := NewCollector(
+		WithSeries(seriesID),
+		WithSamplingInterval(time.Second),
+		WithClock(fc),
+	)
+	var n float64
+	require.NoError(t, c.AddInputFunc(func(g *Gather) error {
+		n++
+		g.Add("virtual:count", n, GaugeType(UnitShort))
+		return nil
+	}))
+	products := make(chan Product, 10)
+	c.AddOutputFunc(func(p Product) error {
+		products <- p
+		return nil
+	})
+	c.Start()
+	defer c.Stop()
+
+	fc.BlockUntil(1)
+	for i := 1; i <= 3; i++ {
+		fc.Advance(time.Second)
+		p := <-products
+		require.Equal(t, start.Add(time.Duration(i)*time.Second), p.Time)
+		require.Equal(t, float64(i), p.Value.(*GaugeValue).Value)
+	}
+}
+
+type slowDeInitOutput struct {
+	release chan struct{}
+}
+
+func (so *slowDeInitOutput) Process(Product) error { return nil }
+
+func (so *slowDeInitOutput) DeInit() { <-so.release }
+
+func TestCollectorLifecycle(t *testing.T) {
+	fc := NewFakeClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	c := NewCollector(WithSamplingInterval(time.Second), WithClock(fc))
+	gathered := make(chan struct{}, 10)
+	require.NoError(t, c.AddInputFunc(func(g *Gather) error {
+		gathered <- struct{}{}
+		return nil
+	}))
+	<-gathered // the initial gathering
+	out := &slowDeInitOutput{release: make(chan struct{})}
+	require.NoError(t, c.AddOutput(out))
+
+	// only one loop is started
+	c.Start()
+	c.Start()
+	fc.BlockUntil(1)
+	fc.Advance(time.Second)
+	<-gathered
+	time.Sleep(10 * time.Millisecond)
+	require.Empty(t, gathered)
+
+	c.Pause()
+	require.True(t, c.Paused())
+	fc.Advance(time.Second)
+	time.Sleep(10 * time.Millisecond)
+	require.Empty(t, gathered)
+
+	c.Resume()
+	fc.Advance(time.Second)
+	<-gathered
+
+	// the output does not return from DeInit() in time
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, c.Shutdown(ctx), context.DeadlineExceeded)
+
+	close(out.release)
+	require.NoError(t, c.Shutdown(context.Background()))
+	c.Stop()
+
+	// a stopped collector is not started again
+	c.Start()
+	fc.Advance(time.Second)
+	time.Sleep(10 * time.Millisecond)
+	require.Empty(t, gathered)
+}
+
+func TestCollectorAbsence(t *testing.T) {
+	seriesID, err := NewSeriesID("ABSENT_1M", "1m/1s", time.Second, 60)
+	require.NoError(t, err)
+	var events []AbsenceEvent
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewCollector(
+		WithSeries(seriesID),
+		WithSamplingInterval(time.Second),
+		WithAbsence(3, func(ev AbsenceEvent) { events = append(events, ev) }),
+		WithAbsenceMetric("metric:absent"),
+		WithClock(NewFakeClock(now)),
+	)
+	defer c.Stop()
+	// the input is not gathered until the collector starts
+	require.NoError(t, c.AddInputWithOptions(&InputFuncWrapper{func(g *Gather) error { return nil }},
+		InputName("idle"), InputInitialDelay(time.Hour)))
+
+	c.receive(&Gather{ts: now, input: "cpu", measures: []Measure{
+		{Name: "cpu:user", Value: 1, Type: GaugeType(UnitPercent)},
+		{Name: "cpu:system", Value: 1, Type: GaugeType(UnitPercent)},
+	}})
+	for i := 1; i <= 4; i++ {
+		tm := now.Add(time.Duration(i) * time.Second)
+		c.receive(&Gather{ts: tm, input: "cpu", measures: []Measure{
+			{Name: "cpu:user", Value: 1, Type: GaugeType(UnitPercent)},
+		}})
+		c.receive(&Gather{ts: tm, noop: true})
+	}
+	require.Equal(t, []AbsenceEvent{
+		{Input: "idle", Time: now.Add(4 * time.Second), Absent: true},
+		{Key: "cpu:system", Input: "cpu", LastSeen: now, Time: now.Add(4 * time.Second), Absent: true},
+	}, events)
+
+	stale := c.Staleness()
+	require.Equal(t, "cpu:system", stale[0].Key)
+	require.True(t, stale[0].Absent)
+	require.False(t, stale[1].Absent)
+	require.Equal(t, []InputStatus{{Name: "idle", Absent: true}}, c.InputStatus())
+
+	sn, err := c.Inflight("metric:absent")
+	require.NoError(t, err)
+	require.Equal(t, 2.0, sn["ABSENT_1M"].Value.(*GaugeValue).Value)
+
+	// reported back
+	events = events[:0]
+	c.receive(&Gather{ts: now.Add(5 * time.Second), input: "cpu", measures: []Measure{
+		{Name: "cpu:system", Value: 1, Type: GaugeType(UnitPercent)},
+	}})
+	require.Equal(t, []AbsenceEvent{
+		{Key: "cpu:system", Input: "cpu", LastSeen: now.Add(5 * time.Second), Time: now.Add(5 * time.Second)},
+	}, events)
+}
+
+func TestCollectorMaxMetrics(t *testing.T) {
+	seriesID, err := NewSeriesID("MAX_1M", "1m/1s", time.Second, 60)
+	require.NoError(t, err)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	send := func(c *Collector, offset time.Duration, names ...string) {
+		g := &Gather{ts: now.Add(offset)}
+		for _, name := range names {
+			g.Add(name, 1, CounterType(UnitShort))
+		}
+		c.receive(g)
+	}
+
+	c := NewCollector(WithSeries(seriesID), WithPrefix("max_drop"), WithMaxMetrics(2, CardinalityDropNew))
+	send(c, 0, "a", "b")
+	send(c, time.Second, "c", "a")
+	require.ElementsMatch(t, []string{"a", "b"}, c.MetricNames())
+	require.Equal(t, int64(1), c.RejectedMetrics())
+	c.Stop()
+
+	c = NewCollector(WithSeries(seriesID), WithPrefix("max_evict"), WithMaxMetrics(2, CardinalityEvictIdle))
+	send(c, 0, "a", "b")
+	send(c, time.Second, "a")
+	send(c, 2*time.Second, "c")
+	require.ElementsMatch(t, []string{"a", "c"}, c.MetricNames())
+	require.Equal(t, int64(0), c.RejectedMetrics())
+	require.Equal(t, int64(1), c.EvictedMetrics())
+	c.Stop()
+}
+
+func TestCollectorRollup(t *testing.T) {
+	fine, err := NewSeriesID("FINE", "1m/1s", time.Second, 60)
+	require.NoError(t, err)
+	coarse, err := NewSeriesID("COARSE", "10m/10s", 10*time.Second, 60)
+	require.NoError(t, err)
+	raw, err := NewSeriesID("RAW", "10m/10s", 10*time.Second, 60)
+	require.NoError(t, err)
+
+	c := NewCollector(WithSeries(raw), WithRollupChain(fine, coarse))
+	var mu sync.Mutex
+	products := map[string][]Product{}
+	c.AddOutputFunc(func(p Product) error {
+		mu.Lock()
+		products[p.SeriesID] = append(products[p.SeriesID], p)
+		mu.Unlock()
+		return nil
+	})
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 25 {
+		c.receive(&Gather{ts: now.Add(time.Duration(i) * time.Second), measures: []Measure{
+			{Name: "req", Value: float64(i), Type: MeterType(UnitShort)},
+		}})
+	}
+	c.receive(&Gather{ts: now.Add(30 * time.Second), noop: true})
+
+	require.Len(t, products["FINE"], 25)
+	require.Len(t, products["COARSE"], 3)
+	require.Len(t, products["RAW"], 3)
+	for i := range products["RAW"] {
+		r, cp := products["RAW"][i], products["COARSE"][i]
+		require.Equal(t, r.Time, cp.Time)
+		require.Equal(t, r.Value, cp.Value)
+	}
+	require.Equal(t, &MeterValue{Samples: 10, Sum: 145, First: 10, Last: 19, Min: 10, Max: 19},
+		products["COARSE"][1].Value)
+}
+
+func TestCollectorRollupOrder(t *testing.T) {
+	fine, err := NewSeriesID("FINE", "1m/1s", time.Second, 60)
+	require.NoError(t, err)
+	coarse, err := NewSeriesID("COARSE", "10m/10s", 10*time.Second, 60)
+	require.NoError(t, err)
+	other, err := NewSeriesID("OTHER", "10m/10s", 10*time.Second, 60)
+	require.NoError(t, err)
+
+	// the coarse series is added before its source
+	c := NewCollector(WithSeries(coarse, other), WithRollupChain(fine, coarse))
+	defer c.Stop()
+	require.Equal(t, []SeriesID{fine, coarse, other}, c.series)
+	var products []Product
+	c.AddOutputFunc(func(p Product) error {
+		if p.SeriesID == "COARSE" {
+			products = append(products, p)
+		}
+		return nil
+	})
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 20 {
+		c.receive(&Gather{ts: now.Add(time.Duration(i) * time.Second), measures: []Measure{
+			{Name: "req", Value: 1, Type: CounterType(UnitShort)},
+		}})
+	}
+	c.receive(&Gather{ts: now.Add(30 * time.Second), noop: true})
+	require.Len(t, products, 2)
+	for _, p := range products {
+		require.Equal(t, &CounterValue{Samples: 10, Value: 10}, p.Value)
+	}
+
+	require.Panics(t, func() {
+		minute, _ := NewSeriesID("MINUTE", "1h/1m", time.Minute, 60)
+		WithRollupChain(coarse, fine, minute)
+	})
+	require.Panics(t, func() {
+		odd, _ := NewSeriesID("ODD", "1h/15s", 15*time.Second, 60)
+		WithRollupChain(coarse, odd)
+	})
+}
+
+func TestCollectorComputed(t *testing.T) {
+	seriesID, err := NewSeriesID("COMPUTED_1M", "1m/1s", time.Second, 60)
+	require.NoError(t, err)
+	c := NewCollector(WithSeries(seriesID),
+		WithComputed("mem:used_percent", MustParseExpr("mem:used / mem:total * 100"), GaugeType(UnitPercent)),
+	)
+	require.NoError(t, c.AddComputed("mem:free_percent", "100 - mem:used_percent", GaugeType(UnitPercent)))
+	require.Error(t, c.AddComputed("bad", "mem:used +", GaugeType(UnitPercent)))
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	// nothing to compute yet
+	c.receive(&Gather{ts: now, noop: true})
+	require.Empty(t, c.MetricNames())
+
+	c.receive(&Gather{ts: now.Add(time.Second), measures: []Measure{
+		{Name: "mem:used", Value: 512, Type: GaugeType(UnitBytes)},
+		{Name: "mem:total", Value: 2048, Type: GaugeType(UnitBytes)},
+	}})
+	c.receive(&Gather{ts: now.Add(time.Second), noop: true})
+	require.ElementsMatch(t, []string{"mem:used", "mem:total", "mem:used_percent", "mem:free_percent"}, c.MetricNames())
+
+	sn, err := c.Inflight("mem:used_percent")
+	require.NoError(t, err)
+	require.Equal(t, 25.0, sn["COMPUTED_1M"].Value.(*GaugeValue).Value)
+	require.Equal(t, UnitPercent, sn["COMPUTED_1M"].Unit)
+	sn, err = c.Inflight("mem:free_percent")
+	require.NoError(t, err)
+	require.Equal(t, 75.0, sn["COMPUTED_1M"].Value.(*GaugeValue).Value)
+	c.Stop()
+}
+
+func TestCollectorComputedAggregate(t *testing.T) {
+	seriesID, err := NewSeriesID("COMPUTED_1M", "1m/1s", time.Second, 60)
+	require.NoError(t, err)
+	c := NewCollector(WithSeries(seriesID),
+		WithComputed("cpu:total", MustParseExpr("sum(cpu:*)"), GaugeType(UnitShort)),
+		WithComputed("cpu:avg", MustParseExpr("cpu:total / count(cpu:*)"), GaugeType(UnitShort)),
+	)
+	defer c.Stop()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	// the computed metrics do not count themselves on the later ticks
+	for i := range 4 {
+		ts := now.Add(time.Duration(i) * time.Second)
+		c.receive(&Gather{ts: ts, measures: []Measure{
+			{Name: "cpu:a", Value: 1, Type: GaugeType(UnitShort)},
+			{Name: "cpu:b", Value: 3, Type: GaugeType(UnitShort)},
+		}})
+		c.receive(&Gather{ts: ts, noop: true})
+		sn, err := c.Inflight("cpu:total")
+		require.NoError(t, err)
+		require.Equal(t, 4.0, sn["COMPUTED_1M"].Value.(*GaugeValue).Value)
+		sn, err = c.Inflight("cpu:avg")
+		require.NoError(t, err)
+		require.Equal(t, 2.0, sn["COMPUTED_1M"].Value.(*GaugeValue).Value)
+	}
+}
+
+func TestCollectorComputedTick(t *testing.T) {
+	seriesID, err := NewSeriesID("COMPUTED_1M", "1m/1s", time.Second, 60)
+	require.NoError(t, err)
+	c := NewCollector(WithSeries(seriesID),
+		WithComputed("req:total", MustParseExpr("sum(req:*)"), CounterType(UnitShort)),
+	)
+	defer c.Stop()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	// the counters gathered in a tick are summed as their bins
+	c.receive(&Gather{ts: now, measures: []Measure{
+		{Name: "req:a", Value: 1, Type: CounterType(UnitShort)},
+		{Name: "req:b", Value: 2, Type: CounterType(UnitShort)},
+	}})
+	c.receive(&Gather{ts: now, measures: []Measure{
+		{Name: "req:a", Value: 4, Type: CounterType(UnitShort)},
+	}})
+	c.receive(&Gather{ts: now, noop: true})
+	sn, err := c.Inflight("req:total")
+	require.NoError(t, err)
+	require.Equal(t, 7.0, sn["COMPUTED_1M"].Value.(*CounterValue).Value)
+
+	// the computed metric stops with its sources
+	for i := 1; i <= 3; i++ {
+		c.receive(&Gather{ts: now.Add(time.Duration(i) * time.Second), noop: true})
+	}
+	_, values := c.Timeseries("req:total")[0].All()
+	var samples int64
+	for _, v := range values {
+		if cv, ok := v.(*CounterValue); ok {
+			samples += cv.Samples
+		}
+	}
+	require.Equal(t, int64(1), samples)
+}
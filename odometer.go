@@ -2,6 +2,7 @@ package metric
 
 import (
 	"encoding/json"
+	"fmt"
 	"sync"
 )
 
@@ -14,6 +15,7 @@ func NewOdometerWithValue(v *OdometerValue) *Odometer {
 		first:       v.First,
 		last:        v.Last,
 		samples:     v.Samples,
+		reset:       v.Reset,
 		initialized: !(v.First == 0 && v.Last == 0 && v.Samples == 0),
 	}
 }
@@ -25,7 +27,9 @@ type Odometer struct {
 	first       float64
 	last        float64
 	samples     int64
+	reset       float64 // sum of the values before the resets
 	initialized bool
+	derivers    []Deriver
 }
 
 func (om *Odometer) MarshalJSON() ([]byte, error) {
@@ -40,12 +44,18 @@ func (om *Odometer) UnmarshalJSON(data []byte) error {
 	om.first = p.First
 	om.last = p.Last
 	om.samples = p.Samples
+	om.reset = p.Reset
 	om.initialized = !(om.first == 0 && om.last == 0 && om.samples == 0)
 	return nil
 }
 
+func (om *Odometer) WithDerivers(derivers ...Deriver) *Odometer {
+	om.derivers = append(om.derivers, derivers...)
+	return om
+}
+
 func (om *Odometer) Derivers() []Deriver {
-	return nil
+	return om.derivers
 }
 
 func (om *Odometer) Add(v float64) {
@@ -58,9 +68,34 @@ func (om *Odometer) Add(v float64) {
 		om.initialized = true
 		return
 	}
+	if v < om.last {
+		om.reset += om.last
+	}
 	om.last = v
 }
 
+func (om *Odometer) Merge(v Value) error {
+	ov, ok := v.(*OdometerValue)
+	if !ok {
+		return fmt.Errorf("%w: %T into odometer", ErrNotMergeable, v)
+	}
+	if ov.Samples == 0 {
+		return nil
+	}
+	om.Lock()
+	defer om.Unlock()
+	if !om.initialized {
+		om.first = ov.First
+		om.initialized = true
+	} else if ov.First < om.last {
+		om.reset += om.last
+	}
+	om.last = ov.Last
+	om.samples += ov.Samples
+	om.reset += ov.Reset
+	return nil
+}
+
 func (om *Odometer) Produce(reset bool) Value {
 	om.Lock()
 	defer om.Unlock()
@@ -68,10 +103,12 @@ func (om *Odometer) Produce(reset bool) Value {
 		First:   om.first,
 		Last:    om.last,
 		Samples: om.samples,
+		Reset:   om.reset,
 	}
 	if reset {
 		om.first = om.last
 		om.samples = 0
+		om.reset = 0
 	}
 	return v
 }
@@ -85,6 +122,11 @@ type OdometerValue struct {
 	First   float64 `json:"first"`
 	Last    float64 `json:"last"`
 	Samples int64   `json:"samples"`
+	// Sum of the values before the resets, a value lower than the previous one is a reset.
+	Reset float64 `json:"reset,omitempty"`
+
+	// Optional derived values, such as rates
+	DerivedValues DerivedValues `json:"derived,omitempty"`
 }
 
 func (ov *OdometerValue) String() string {
@@ -92,6 +134,22 @@ func (ov *OdometerValue) String() string {
 	return string(b)
 }
 
+func (ov *OdometerValue) SetDerivedValue(name string, value Value) {
+	if ov.DerivedValues == nil {
+		ov.DerivedValues = make(DerivedValues)
+	}
+	ov.DerivedValues[name] = value
+}
+
+// Increase returns the increase of the odometer as a counter,
+// which restarts from zero on a reset, like increase() of Prometheus.
+func (ov *OdometerValue) Increase() float64 {
+	if ov.Samples == 0 {
+		return 0
+	}
+	return ov.Last - ov.First + ov.Reset
+}
+
 func (ov *OdometerValue) Diff() float64 {
 	if ov.Samples == 0 {
 		return 0
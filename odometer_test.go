@@ -47,3 +47,27 @@ func TestOdometerJSON(t *testing.T) {
 	require.Equal(t, om.last, om2.last)
 	require.Equal(t, om.initialized, om2.initialized)
 }
+
+func TestOdometerReset(t *testing.T) {
+	om := NewOdometer()
+	for _, v := range []float64{10, 20, 5, 15} {
+		om.Add(v)
+	}
+	d := om.Produce(true).(*OdometerValue)
+	require.Equal(t, 5.0, d.Diff())
+	require.Equal(t, 20.0, d.Reset)
+	require.Equal(t, 25.0, d.Increase())
+
+	data, err := json.Marshal(d)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"first":10,"last":15,"samples":4,"reset":20}`, string(data))
+
+	// a reset between the merged values
+	om.Add(3)
+	om2 := NewOdometer()
+	require.NoError(t, om2.Merge(d))
+	require.NoError(t, om2.Merge(om.Produce(true)))
+	d = om2.Produce(false).(*OdometerValue)
+	require.Equal(t, 35.0, d.Reset)
+	require.Equal(t, 28.0, d.Increase())
+}
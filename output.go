@@ -0,0 +1,275 @@
+package metric
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BatchOutput is an optional interface of Output.
+// If the output of AsyncOutput implements it, the Products are delivered in batches.
+type BatchOutput interface {
+	ProcessBatch([]Product) error
+}
+
+// AsyncOutput wraps an Output so that the collector does not wait for it.
+// Products are queued in a bounded buffer and delivered by a background goroutine
+// in batches, failed deliveries are retried with exponential backoff.
+//
+// The background goroutine is started by Init() and stopped by DeInit(),
+// which are called by the collector in AddOutput() and Stop() respectively.
+type AsyncOutput struct {
+	output        Output
+	queue         chan Product
+	batchSize     int
+	flushInterval time.Duration
+	maxRetries    int
+	backoff       time.Duration
+	maxBackoff    time.Duration
+	overflow      OverflowPolicy
+	sampler       overflowSampler
+	clock         Clock
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	closeCh   chan struct{}
+	doneCh    chan struct{}
+	closed    atomic.Bool
+
+	processed atomic.Int64
+	dropped   atomic.Int64
+	retried   atomic.Int64
+}
+
+var _ Output = (*AsyncOutput)(nil)
+
+type AsyncOutputOption func(*AsyncOutput)
+
+// AsyncQueueSize sets the size of the buffer of the queued Products,
+// a size less than 1 is the default, which is 1000.
+func AsyncQueueSize(size int) AsyncOutputOption {
+	return func(ao *AsyncOutput) {
+		if size < 1 {
+			ao.queue = nil
+			return
+		}
+		ao.queue = make(chan Product, size)
+	}
+}
+
+// AsyncBatch sets the maximum number of Products in a batch,
+// and the interval to flush a batch that is not full.
+// Default is 100 Products and 1 second.
+func AsyncBatch(size int, flushInterval time.Duration) AsyncOutputOption {
+	return func(ao *AsyncOutput) {
+		ao.batchSize = size
+		ao.flushInterval = flushInterval
+	}
+}
+
+// AsyncRetry sets the maximum number of retries of a failed delivery,
+// and the initial and maximum backoff between retries. The backoff doubles on each retry.
+// Default is 3 retries with backoff from 100ms to 10s.
+func AsyncRetry(maxRetries int, backoff time.Duration, maxBackoff time.Duration) AsyncOutputOption {
+	return func(ao *AsyncOutput) {
+		ao.maxRetries = maxRetries
+		ao.backoff = backoff
+		ao.maxBackoff = maxBackoff
+	}
+}
+
+// AsyncOverflow sets the policy when the queue is full.
+// Default is OverflowDropOldest, which never blocks the collector.
+func AsyncOverflow(policy OverflowPolicy) AsyncOutputOption {
+	return func(ao *AsyncOutput) {
+		ao.overflow = policy
+	}
+}
+
+// AsyncOverflowSampleRate sets N of the OverflowSample policy,
+// one of every N Products is kept while the queue is full. Default is 10.
+func AsyncOverflowSampleRate(n int) AsyncOutputOption {
+	return func(ao *AsyncOutput) {
+		ao.sampler.rate = int64(n)
+	}
+}
+
+// AsyncClock sets the clock of the flush interval and the backoff of the retries.
+// Default is SystemClock().
+func AsyncClock(clock Clock) AsyncOutputOption {
+	return func(ao *AsyncOutput) {
+		ao.clock = clock
+	}
+}
+
+func NewAsyncOutput(output Output, opts ...AsyncOutputOption) *AsyncOutput {
+	ao := &AsyncOutput{
+		output:        output,
+		batchSize:     100,
+		flushInterval: time.Second,
+		maxRetries:    3,
+		backoff:       100 * time.Millisecond,
+		maxBackoff:    10 * time.Second,
+		overflow:      OverflowDropOldest,
+		sampler:       overflowSampler{rate: 10},
+		clock:         SystemClock(),
+		closeCh:       make(chan struct{}),
+		doneCh:        make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(ao)
+	}
+	if ao.queue == nil {
+		ao.queue = make(chan Product, 1000)
+	}
+	if ao.clock == nil {
+		ao.clock = SystemClock()
+	}
+	if ao.batchSize <= 0 {
+		ao.batchSize = 1
+	}
+	if ao.flushInterval <= 0 {
+		ao.flushInterval = time.Second
+	}
+	return ao
+}
+
+// Name returns the name of the wrapped output,
+// so that Collector.RemoveOutputByName() can find it.
+func (ao *AsyncOutput) Name() string {
+	return pluginName(ao.output)
+}
+
+func (ao *AsyncOutput) Init() error {
+	if hasInit, ok := ao.output.(interface{ Init() error }); ok {
+		if err := hasInit.Init(); err != nil {
+			return err
+		}
+	}
+	ao.startOnce.Do(func() { go ao.run() })
+	return nil
+}
+
+// Process queues the Product, it never waits for the wrapped output.
+// If the queue is full, the overflow policy decides which Product is dropped.
+func (ao *AsyncOutput) Process(p Product) error {
+	if ao.closed.Load() {
+		ao.dropped.Add(1)
+		return nil
+	}
+	_, dropped := enqueue(ao.queue, p, ao.overflow, &ao.sampler, nil, ao.closeCh)
+	if dropped > 0 {
+		ao.dropped.Add(int64(dropped))
+	}
+	return nil
+}
+
+// DeInit stops the background goroutine after flushing the queued Products,
+// and then calls DeInit() of the wrapped output if exists.
+func (ao *AsyncOutput) DeInit() {
+	ao.stopOnce.Do(func() {
+		ao.closed.Store(true)
+		close(ao.closeCh)
+		ao.startOnce.Do(func() { go ao.run() })
+		<-ao.doneCh
+		deInit(ao.output)
+	})
+}
+
+// Processed returns the number of Products delivered to the wrapped output.
+func (ao *AsyncOutput) Processed() int64 {
+	return ao.processed.Load()
+}
+
+// Dropped returns the number of Products dropped by the overflow policy
+// or after exhausting the retries.
+func (ao *AsyncOutput) Dropped() int64 {
+	return ao.dropped.Load()
+}
+
+// Retried returns the number of retried deliveries.
+func (ao *AsyncOutput) Retried() int64 {
+	return ao.retried.Load()
+}
+
+func (ao *AsyncOutput) run() {
+	defer close(ao.doneCh)
+	ticker := ao.clock.NewTicker(ao.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Product, 0, ao.batchSize)
+	for {
+		select {
+		case p := <-ao.queue:
+			batch = append(batch, p)
+			if len(batch) >= ao.batchSize {
+				ao.flush(batch)
+				batch = make([]Product, 0, ao.batchSize)
+			}
+		case <-ticker.C():
+			if len(batch) > 0 {
+				ao.flush(batch)
+				batch = make([]Product, 0, ao.batchSize)
+			}
+		case <-ao.closeCh:
+			// drain the queue
+			for {
+				select {
+				case p := <-ao.queue:
+					batch = append(batch, p)
+					if len(batch) >= ao.batchSize {
+						ao.flush(batch)
+						batch = make([]Product, 0, ao.batchSize)
+					}
+				default:
+					if len(batch) > 0 {
+						ao.flush(batch)
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush delivers the batch, retrying the undelivered Products with exponential backoff.
+func (ao *AsyncOutput) flush(batch []Product) {
+	backoff := ao.backoff
+	for retries := 0; ; retries++ {
+		n, err := ao.deliver(batch)
+		ao.processed.Add(int64(n))
+		batch = batch[n:]
+		if err == nil {
+			return
+		}
+		if retries >= ao.maxRetries {
+			slog.Error("Error processing async output, dropped", "name", ao.Name(), "products", len(batch), "error", err)
+			ao.dropped.Add(int64(len(batch)))
+			return
+		}
+		ao.retried.Add(1)
+		select {
+		case <-ao.clock.After(backoff):
+		case <-ao.closeCh:
+			// retry immediately when closing
+		}
+		backoff = min(backoff*2, ao.maxBackoff)
+	}
+}
+
+// deliver returns the number of Products delivered before an error occurs.
+func (ao *AsyncOutput) deliver(batch []Product) (int, error) {
+	if bo, ok := ao.output.(BatchOutput); ok {
+		if err := bo.ProcessBatch(batch); err != nil {
+			return 0, err
+		}
+		return len(batch), nil
+	}
+	for i, p := range batch {
+		if err := ao.output.Process(p); err != nil {
+			return i, err
+		}
+	}
+	return len(batch), nil
+}
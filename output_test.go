@@ -0,0 +1,151 @@
+package metric
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type flakyOutput struct {
+	sync.Mutex
+	failures int
+	batches  [][]Product
+}
+
+func (fo *flakyOutput) Process(p Product) error {
+	return fo.ProcessBatch([]Product{p})
+}
+
+func (fo *flakyOutput) ProcessBatch(batch []Product) error {
+	fo.Lock()
+	defer fo.Unlock()
+	if fo.failures > 0 {
+		fo.failures--
+		return errors.New("temporary failure")
+	}
+	fo.batches = append(fo.batches, batch)
+	return nil
+}
+
+func TestAsyncOutputRetry(t *testing.T) {
+	out := &flakyOutput{failures: 2}
+	ao := NewAsyncOutput(out,
+		AsyncBatch(3, time.Hour),
+		AsyncRetry(3, time.Millisecond, 4*time.Millisecond),
+	)
+	require.NoError(t, ao.Init())
+	for i := range 7 {
+		require.NoError(t, ao.Process(Product{Name: "m", Time: time.Unix(int64(i), 0)}))
+	}
+	// the last partial batch is flushed by DeInit
+	ao.DeInit()
+
+	require.Equal(t, int64(7), ao.Processed())
+	require.Equal(t, int64(2), ao.Retried())
+	require.Equal(t, int64(0), ao.Dropped())
+	require.Len(t, out.batches, 3)
+	require.Len(t, out.batches[0], 3)
+	require.Len(t, out.batches[2], 1)
+
+	// Process after DeInit is dropped
+	require.NoError(t, ao.Process(Product{Name: "m"}))
+	require.Equal(t, int64(1), ao.Dropped())
+}
+
+func TestAsyncOutputGiveUp(t *testing.T) {
+	out := &flakyOutput{failures: 100}
+	ao := NewAsyncOutput(out, AsyncBatch(2, time.Hour), AsyncRetry(1, time.Millisecond, time.Millisecond))
+	require.NoError(t, ao.Init())
+	require.NoError(t, ao.Process(Product{Name: "m"}))
+	require.NoError(t, ao.Process(Product{Name: "m"}))
+	ao.DeInit()
+	require.Equal(t, int64(0), ao.Processed())
+	require.Equal(t, int64(1), ao.Retried())
+	require.Equal(t, int64(2), ao.Dropped())
+}
+
+type blockingOutput struct {
+	release chan struct{}
+	count   int
+}
+
+func (bo *blockingOutput) Process(p Product) error {
+	<-bo.release
+	bo.count++
+	return nil
+}
+
+func TestAsyncOutputOverflow(t *testing.T) {
+	for _, tc := range []struct {
+		policy    OverflowPolicy
+		firstName string
+	}{
+		{OverflowDropNewest, "m0"},
+		{OverflowDropOldest, "m8"},
+	} {
+		out := &blockingOutput{release: make(chan struct{})}
+		ao := NewAsyncOutput(out, AsyncQueueSize(2), AsyncBatch(1, time.Hour), AsyncOverflow(tc.policy))
+		// without Init, nothing consumes the queue
+		for i := range 10 {
+			require.NoError(t, ao.Process(Product{Name: "m" + string(rune('0'+i))}))
+		}
+		require.Equal(t, int64(8), ao.Dropped(), tc.policy.String())
+		p := <-ao.queue
+		require.Equal(t, tc.firstName, p.Name, tc.policy.String())
+		close(out.release)
+		ao.DeInit()
+		require.Equal(t, 1, out.count)
+	}
+}
+
+func TestAsyncOutputClock(t *testing.T) {
+	fc := NewFakeClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	out := &flakyOutput{failures: 1}
+	ao := NewAsyncOutput(out, AsyncClock(fc), AsyncBatch(10, time.Second),
+		AsyncRetry(3, time.Minute, time.Minute))
+	require.NoError(t, ao.Init())
+	defer ao.DeInit()
+	require.NoError(t, ao.Process(Product{Name: "m"}))
+
+	// the partial batch is flushed by the ticker, and fails once
+	fc.BlockUntil(1)
+	fc.Advance(time.Second)
+	fc.BlockUntil(2)
+	require.Equal(t, int64(1), ao.Retried())
+	require.Equal(t, int64(0), ao.Processed())
+
+	// the retry waits for the backoff
+	fc.Advance(time.Minute)
+	require.Eventually(t, func() bool { return ao.Processed() == 1 }, time.Second, time.Millisecond)
+}
+
+func TestAsyncOutputQueueSize(t *testing.T) {
+	for _, size := range []int{0, -1} {
+		ao := NewAsyncOutput(&flakyOutput{}, AsyncQueueSize(size), AsyncOverflow(OverflowDropOldest))
+		require.Equal(t, 1000, cap(ao.queue))
+		for range 10 {
+			require.NoError(t, ao.Process(Product{Name: "m"}))
+		}
+		require.Equal(t, int64(0), ao.Dropped())
+	}
+}
+
+func TestAsyncOutputCollector(t *testing.T) {
+	seriesID, err := NewSeriesID("ASYNC_1S", "1s", 10*time.Millisecond, 10)
+	require.NoError(t, err)
+	c := NewCollector(WithSamplingInterval(10*time.Millisecond), WithSeries(seriesID))
+	out := &flakyOutput{}
+	ao := NewAsyncOutput(out, AsyncBatch(10, 10*time.Millisecond))
+	require.NoError(t, c.AddOutput(ao))
+	require.NoError(t, c.AddInputFunc(func(g *Gather) error {
+		g.Add("async:m", 1, CounterType(UnitShort))
+		return nil
+	}))
+	c.Start()
+	require.Eventually(t, func() bool { return ao.Processed() >= 3 }, time.Second, 5*time.Millisecond)
+	c.Stop()
+	require.Equal(t, "*metric.flakyOutput", ao.Name())
+}
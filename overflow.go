@@ -0,0 +1,164 @@
+package metric
+
+import (
+	"slices"
+	"sync/atomic"
+)
+
+// OverflowPolicy determines what happens when an item is added to a full buffer.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits until there is room in the buffer.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest drops the item being added.
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest item in the buffer to make room.
+	OverflowDropOldest
+	// OverflowSample keeps one of every N items, by dropping the oldest item in the buffer,
+	// and drops the others while the buffer is full.
+	OverflowSample
+)
+
+func (op OverflowPolicy) String() string {
+	switch op {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropNewest:
+		return "drop-newest"
+	case OverflowDropOldest:
+		return "drop-oldest"
+	case OverflowSample:
+		return "sample"
+	default:
+		return "unknown"
+	}
+}
+
+// overflowSampler decides which items are kept by OverflowSample.
+type overflowSampler struct {
+	rate int64
+	seq  atomic.Int64
+}
+
+// keep returns true for one of every rate calls.
+func (os *overflowSampler) keep() bool {
+	if os == nil || os.rate <= 1 {
+		return true
+	}
+	return os.seq.Add(1)%os.rate == 0
+}
+
+// enqueue adds v to ch according to the policy.
+// It returns whether v is added and the number of items that are dropped.
+// The OverflowBlock policy gives up when done is closed.
+// The items for which pinned returns true are never dropped to make room,
+// they are put back in their order and the oldest item that is not pinned is dropped instead.
+func enqueue[T any](ch chan T, v T, policy OverflowPolicy, sampler *overflowSampler, pinned func(T) bool, done <-chan struct{}) (bool, int) {
+	switch policy {
+	case OverflowSample:
+		select {
+		case ch <- v:
+			return true, 0
+		default:
+		}
+		if !sampler.keep() {
+			return false, 1
+		}
+		return enqueue(ch, v, OverflowDropOldest, nil, pinned, done)
+	case OverflowDropNewest:
+		select {
+		case ch <- v:
+			return true, 0
+		default:
+			return false, 1
+		}
+	case OverflowDropOldest:
+		dropped := 0
+		for {
+			select {
+			case ch <- v:
+				return true, dropped
+			default:
+			}
+			select {
+			case old := <-ch:
+				if pinned == nil || !pinned(old) {
+					dropped++
+					continue
+				}
+				ok, n := requeue(ch, old, v, pinned, done)
+				return ok, dropped + n
+			default:
+				// nothing to drop, the channel has no buffer
+				if cap(ch) == 0 {
+					return false, dropped + 1
+				}
+			}
+		}
+	default:
+		select {
+		case ch <- v:
+			return true, 0
+		case <-done:
+			return false, 1
+		}
+	}
+}
+
+// requeue puts the pinned item taken from the head of ch back with the items behind it and v,
+// dropping the oldest of them that is not pinned to make room, or v if all are pinned.
+// It never waits, the items that lose their room to other senders meanwhile are dropped
+// except the pinned ones, which are sent by a goroutine until done is closed.
+func requeue[T any](ch chan T, head, v T, pinned func(T) bool, done <-chan struct{}) (bool, int) {
+	items := []T{head}
+drain:
+	for len(items) < cap(ch) {
+		select {
+		case item := <-ch:
+			items = append(items, item)
+		default:
+			break drain
+		}
+	}
+	added, dropped := true, 0
+	if len(items) == cap(ch) {
+		dropped = 1
+		if i := slices.IndexFunc(items, func(item T) bool { return !pinned(item) }); i >= 0 {
+			items = slices.Delete(items, i, i+1)
+		} else {
+			added = false
+		}
+	}
+	if added {
+		items = append(items, v)
+	}
+	for i, item := range items {
+		select {
+		case ch <- item:
+			continue
+		default:
+		}
+		var late []T
+		for _, item := range items[i:] {
+			if pinned(item) {
+				late = append(late, item)
+			} else {
+				dropped++
+			}
+		}
+		// v is the last of the rest if added
+		added = added && pinned(v)
+		go func() {
+			for _, item := range late {
+				select {
+				case ch <- item:
+				case <-done:
+					return
+				}
+			}
+		}()
+		break
+	}
+	return added, dropped
+}
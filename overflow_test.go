@@ -0,0 +1,31 @@
+package metric
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnqueuePinned(t *testing.T) {
+	pinned := func(s string) bool { return s[0] == 't' }
+	done := make(chan struct{})
+	defer close(done)
+
+	ch := make(chan string, 3)
+	ch <- "t1"
+	ch <- "g1"
+	ch <- "t2"
+	ok, dropped := enqueue(ch, "g2", OverflowDropOldest, nil, pinned, done)
+	require.True(t, ok)
+	require.Equal(t, 1, dropped)
+	require.Equal(t, []string{"t1", "t2", "g2"}, []string{<-ch, <-ch, <-ch})
+
+	// a buffer full of pinned items drops the new one without waiting
+	ch <- "t1"
+	ch <- "t2"
+	ch <- "t3"
+	ok, dropped = enqueue(ch, "g1", OverflowDropOldest, nil, pinned, done)
+	require.False(t, ok)
+	require.Equal(t, 1, dropped)
+	require.Equal(t, []string{"t1", "t2", "t3"}, []string{<-ch, <-ch, <-ch})
+}
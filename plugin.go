@@ -0,0 +1,282 @@
+package metric
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PluginKind is either PluginInput or PluginOutput.
+type PluginKind string
+
+const (
+	PluginInput  PluginKind = "input"
+	PluginOutput PluginKind = "output"
+)
+
+// PluginInfo describes a registered input or output.
+type PluginInfo struct {
+	Kind        PluginKind `json:"kind"`
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Defaults    any        `json:"defaults,omitempty"` // the default config
+}
+
+var ErrPluginNotFound = errors.New("plugin not found")
+
+type plugin struct {
+	info  PluginInfo
+	build func(raw map[string]any) (any, error)
+}
+
+var plugins = struct {
+	sync.RWMutex
+	inputs  map[string]*plugin
+	outputs map[string]*plugin
+}{
+	inputs:  make(map[string]*plugin),
+	outputs: make(map[string]*plugin),
+}
+
+// RegisterInput registers a factory of an input by its name, which is usually called in init().
+// The config of an instance is decoded from a map, e.g. a section of the config file,
+// into a deep copy of defaults in the same way as encoding/json with unknown fields rejected,
+// so the fields of defaults that encoding/json does not take are not copied.
+// The time.Duration fields also take the strings that time.ParseDuration accepts, e.g. "5s".
+// It panics if the name is registered already.
+func RegisterInput[C any](name string, description string, defaults C, factory func(C) (Input, error)) {
+	registerPlugin(plugins.inputs, PluginInput, name, description, defaults, func(cfg C) (any, error) {
+		return factory(cfg)
+	})
+}
+
+// RegisterOutput registers a factory of an output by its name, which is usually called in init().
+// See RegisterInput for the config.
+// It panics if the name is registered already.
+func RegisterOutput[C any](name string, description string, defaults C, factory func(C) (Output, error)) {
+	registerPlugin(plugins.outputs, PluginOutput, name, description, defaults, func(cfg C) (any, error) {
+		return factory(cfg)
+	})
+}
+
+func registerPlugin[C any](registry map[string]*plugin, kind PluginKind, name string, description string, defaults C, factory func(C) (any, error)) {
+	if factory == nil {
+		panic(fmt.Sprintf("metric: Register %s %q with nil factory", kind, name))
+	}
+	plugins.Lock()
+	defer plugins.Unlock()
+	if _, dup := registry[name]; dup {
+		panic(fmt.Sprintf("metric: Register called twice for %s %q", kind, name))
+	}
+	registry[name] = &plugin{
+		info: PluginInfo{Kind: kind, Name: name, Description: description, Defaults: defaults},
+		build: func(raw map[string]any) (any, error) {
+			cfg, err := decodePluginConfig(defaults, raw)
+			if err != nil {
+				return nil, fmt.Errorf("%s %q config: %w", kind, name, err)
+			}
+			return factory(cfg)
+		},
+	}
+}
+
+// decodePluginConfig decodes raw into a deep copy of defaults,
+// so that the slices and maps of defaults are not shared by the instances.
+func decodePluginConfig[C any](defaults C, raw map[string]any) (C, error) {
+	var cfg C
+	b, err := json.Marshal(defaults)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return cfg, err
+	}
+	if len(raw) == 0 {
+		return cfg, nil
+	}
+	raw, err = parseDurations(reflect.TypeOf(cfg), raw)
+	if err != nil {
+		return cfg, err
+	}
+	b, err = json.Marshal(raw)
+	if err != nil {
+		return cfg, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+var durationType = reflect.TypeFor[time.Duration]()
+
+// parseDurations returns a copy of raw with the strings of the time.Duration fields of typ,
+// including the ones of the nested structs, parsed by time.ParseDuration,
+// since encoding/json takes only the nanoseconds.
+func parseDurations(typ reflect.Type, raw map[string]any) (map[string]any, error) {
+	for typ != nil && typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return raw, nil
+	}
+	ret := make(map[string]any, len(raw))
+	for key, v := range raw {
+		ret[key] = v
+		field, ok := jsonField(typ, key)
+		if !ok {
+			continue
+		}
+		ft := field.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		switch v := v.(type) {
+		case string:
+			if ft != durationType {
+				continue
+			}
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			ret[key] = int64(d)
+		case map[string]any:
+			sub, err := parseDurations(ft, v)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%w", key, err)
+			}
+			ret[key] = sub
+		}
+	}
+	return ret, nil
+}
+
+// jsonField returns the field of the struct type that encoding/json decodes the key into.
+func jsonField(typ reflect.Type, key string) (reflect.StructField, bool) {
+	for _, f := range reflect.VisibleFields(typ) {
+		tag := f.Tag.Get("json")
+		if !f.IsExported() || f.Anonymous && tag == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if strings.EqualFold(name, key) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// InputPlugins returns the registered inputs sorted by name.
+func InputPlugins() []PluginInfo {
+	return listPlugins(plugins.inputs)
+}
+
+// OutputPlugins returns the registered outputs sorted by name.
+func OutputPlugins() []PluginInfo {
+	return listPlugins(plugins.outputs)
+}
+
+func listPlugins(registry map[string]*plugin) []PluginInfo {
+	plugins.RLock()
+	defer plugins.RUnlock()
+	ret := make([]PluginInfo, 0, len(registry))
+	for _, p := range registry {
+		ret = append(ret, p.info)
+	}
+	slices.SortFunc(ret, func(a, b PluginInfo) int { return cmp.Compare(a.Name, b.Name) })
+	return ret
+}
+
+// DescribePlugin returns the information of the registered input or output.
+func DescribePlugin(kind PluginKind, name string) (PluginInfo, error) {
+	p, err := lookupPlugin(kind, name)
+	if err != nil {
+		return PluginInfo{}, err
+	}
+	return p.info, nil
+}
+
+func lookupPlugin(kind PluginKind, name string) (*plugin, error) {
+	plugins.RLock()
+	defer plugins.RUnlock()
+	var p *plugin
+	switch kind {
+	case PluginInput:
+		p = plugins.inputs[name]
+	case PluginOutput:
+		p = plugins.outputs[name]
+	}
+	if p == nil {
+		return nil, fmt.Errorf("%w: %s %q", ErrPluginNotFound, kind, name)
+	}
+	return p, nil
+}
+
+// NewInputPlugin creates an instance of the registered input with the config.
+func NewInputPlugin(name string, config map[string]any) (Input, error) {
+	p, err := lookupPlugin(PluginInput, name)
+	if err != nil {
+		return nil, err
+	}
+	v, err := p.build(config)
+	if err != nil {
+		return nil, err
+	}
+	in, _ := v.(Input)
+	if in == nil {
+		return nil, fmt.Errorf("input %q: factory returned nil", name)
+	}
+	return in, nil
+}
+
+// NewOutputPlugin creates an instance of the registered output with the config.
+func NewOutputPlugin(name string, config map[string]any) (Output, error) {
+	p, err := lookupPlugin(PluginOutput, name)
+	if err != nil {
+		return nil, err
+	}
+	v, err := p.build(config)
+	if err != nil {
+		return nil, err
+	}
+	out, _ := v.(Output)
+	if out == nil {
+		return nil, fmt.Errorf("output %q: factory returned nil", name)
+	}
+	return out, nil
+}
+
+// AddInputPlugin creates an instance of the registered input and adds it to the collector.
+// The input is named after the plugin unless InputName is given.
+func (c *Collector) AddInputPlugin(name string, config map[string]any, opts ...InputOption) error {
+	in, err := NewInputPlugin(name, config)
+	if err != nil {
+		return err
+	}
+	return c.AddInputWithOptions(in, append([]InputOption{InputName(name)}, opts...)...)
+}
+
+// AddOutputPlugin creates an instance of the registered output and adds it to the collector.
+func (c *Collector) AddOutputPlugin(name string, config map[string]any) error {
+	out, err := NewOutputPlugin(name, config)
+	if err != nil {
+		return err
+	}
+	return c.AddOutput(out)
+}
@@ -0,0 +1,156 @@
+package metric
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type staticInputConfig struct {
+	Measure string  `json:"measure"`
+	Value   float64 `json:"value"`
+}
+
+type captureOutputConfig struct {
+	Capacity int `json:"capacity"`
+}
+
+type captureOutput struct {
+	sync.Mutex
+	capacity int
+	products []Product
+}
+
+func (co *captureOutput) Process(p Product) error {
+	co.Lock()
+	defer co.Unlock()
+	if len(co.products) < co.capacity {
+		co.products = append(co.products, p)
+	}
+	return nil
+}
+
+func init() {
+	RegisterInput("test-static", "gathers a constant value",
+		staticInputConfig{Measure: "static:value", Value: 1},
+		func(cfg staticInputConfig) (Input, error) {
+			return &InputFuncWrapper{func(g *Gather) error {
+				g.Add(cfg.Measure, cfg.Value, GaugeType(UnitShort))
+				return nil
+			}}, nil
+		})
+	RegisterOutput("test-capture", "keeps the products in memory",
+		captureOutputConfig{Capacity: 10},
+		func(cfg captureOutputConfig) (Output, error) {
+			return &captureOutput{capacity: cfg.Capacity}, nil
+		})
+}
+
+func TestPluginRegistry(t *testing.T) {
+	info, err := DescribePlugin(PluginInput, "test-static")
+	require.NoError(t, err)
+	require.Equal(t, "gathers a constant value", info.Description)
+	require.Equal(t, staticInputConfig{Measure: "static:value", Value: 1}, info.Defaults)
+	require.Contains(t, InputPlugins(), info)
+	require.NotEmpty(t, OutputPlugins())
+
+	_, err = DescribePlugin(PluginOutput, "test-static")
+	require.ErrorIs(t, err, ErrPluginNotFound)
+
+	require.Panics(t, func() {
+		RegisterInput("test-static", "", struct{}{}, func(struct{}) (Input, error) { return nil, nil })
+	})
+
+	_, err = NewInputPlugin("test-static", map[string]any{"unknown": 1})
+	require.ErrorContains(t, err, "unknown")
+
+	out, err := NewOutputPlugin("test-capture", map[string]any{"capacity": 3})
+	require.NoError(t, err)
+	require.Equal(t, 3, out.(*captureOutput).capacity)
+}
+
+func TestPluginDefaults(t *testing.T) {
+	type config struct {
+		Tags []string          `json:"tags"`
+		Hdr  map[string]string `json:"hdr"`
+	}
+	defaults := config{Tags: []string{"a", "b"}, Hdr: map[string]string{"k": "v"}}
+	cfg, err := decodePluginConfig(defaults, map[string]any{"tags": []string{"x"}, "hdr": map[string]string{"z": "1"}})
+	require.NoError(t, err)
+	require.Equal(t, config{Tags: []string{"x"}, Hdr: map[string]string{"k": "v", "z": "1"}}, cfg)
+	require.Equal(t, config{Tags: []string{"a", "b"}, Hdr: map[string]string{"k": "v"}}, defaults)
+
+	cfg, err = decodePluginConfig(defaults, nil)
+	require.NoError(t, err)
+	cfg.Tags[0] = "y"
+	require.Equal(t, "a", defaults.Tags[0])
+}
+
+func TestPluginDurations(t *testing.T) {
+	type retry struct {
+		Backoff time.Duration `json:"backoff"`
+	}
+	type config struct {
+		Interval time.Duration `json:"interval"`
+		Timeout  time.Duration
+		Retry    *retry `json:"retry"`
+	}
+	defaults := config{Interval: time.Second, Retry: &retry{Backoff: time.Second}}
+	cfg, err := decodePluginConfig(defaults, map[string]any{
+		"interval": "5s",
+		"timeout":  int64(time.Minute),
+		"retry":    map[string]any{"backoff": "100ms"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, config{Interval: 5 * time.Second, Timeout: time.Minute, Retry: &retry{Backoff: 100 * time.Millisecond}}, cfg)
+	require.Equal(t, time.Second, defaults.Retry.Backoff)
+
+	_, err = decodePluginConfig(defaults, map[string]any{"retry": map[string]any{"backoff": "soon"}})
+	require.ErrorContains(t, err, "retry.backoff")
+}
+
+func TestCollectorPlugins(t *testing.T) {
+	seriesID, err := NewSeriesID("PLUGIN_1M", "1m/1s", time.Second, 60)
+	require.NoError(t, err)
+	c := NewCollector(WithSeries(seriesID))
+	require.NoError(t, c.AddInputPlugin("test-static", map[string]any{"measure": "static:answer", "value": 42}))
+	require.NoError(t, c.AddOutputPlugin("test-capture", nil))
+	require.ErrorIs(t, c.AddInputPlugin("missing", nil), ErrPluginNotFound)
+
+	require.Equal(t, "test-static", c.InputStatus()[0].Name)
+	require.Equal(t, []string{"static:answer"}, c.MetricNames())
+	c.Stop()
+}
+
+func TestConfigPlugins(t *testing.T) {
+	cfg, err := ParseConfig([]byte(`
+series:
+  - { id: MIN, period: 1s, max_count: 60 }
+inputs:
+  - { type: test-static, name: answer, interval: 1m, config: { measure: "static:answer", value: 42 } }
+outputs:
+  - { type: test-capture, config: { capacity: 5 } }
+`), "yaml")
+	require.NoError(t, err)
+	c, err := cfg.NewCollector(nil)
+	require.NoError(t, err)
+	status := c.InputStatus()
+	require.Len(t, status, 1)
+	require.Equal(t, "answer", status[0].Name)
+	require.Equal(t, time.Minute, status[0].Interval)
+	c.Stop()
+
+	_, err = ParseConfig([]byte("inputs:\n  - { type: missing }"), "yaml")
+	var ce *ConfigError
+	require.ErrorAs(t, err, &ce)
+	require.Equal(t, "inputs[0].type", ce.Key)
+	require.ErrorIs(t, err, ErrPluginNotFound)
+
+	cfg, err = ParseConfig([]byte("inputs:\n  - { type: test-static, config: { value: abc } }"), "yaml")
+	require.NoError(t, err)
+	_, err = cfg.NewCollector(nil)
+	require.ErrorAs(t, err, &ce)
+	require.Equal(t, "inputs[0]", ce.Key)
+}
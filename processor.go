@@ -0,0 +1,126 @@
+package metric
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Processor transforms the measures of a gathering before they are stored in the time series.
+// It can rename, scale, drop, duplicate or enrich the measures,
+// the returned measures replace the given ones.
+// Processors are called in the order they are added, from the collector loop.
+type Processor interface {
+	Apply([]Measure) []Measure
+}
+
+// ProcessorFunc is a function type that implements Processor.
+type ProcessorFunc func([]Measure) []Measure
+
+var _ Processor = ProcessorFunc(nil)
+
+func (f ProcessorFunc) Apply(measures []Measure) []Measure {
+	return f(measures)
+}
+
+// RenameProcessor renames the measures whose names match the regular expression,
+// the replacement can refer to the submatches, e.g. "$1".
+type RenameProcessor struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+var _ Processor = (*RenameProcessor)(nil)
+
+func NewRenameProcessor(pattern string, replacement string) (*RenameProcessor, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("rename processor: %w", err)
+	}
+	return &RenameProcessor{re: re, replacement: replacement}, nil
+}
+
+func (rp *RenameProcessor) Apply(measures []Measure) []Measure {
+	for i := range measures {
+		if rp.re.MatchString(measures[i].Name) {
+			measures[i].Name = rp.re.ReplaceAllString(measures[i].Name, rp.replacement)
+		}
+	}
+	return measures
+}
+
+// ScaleProcessor multiplies the values of the measures that match the filter by Factor,
+// and then adds Offset. If Unit is set, the unit of the measures is changed,
+// e.g. Factor 1/1024 with a unit of KB.
+type ScaleProcessor struct {
+	Filter Filter // nil matches all measures
+	Factor float64
+	Offset float64
+	Unit   Unit
+}
+
+var _ Processor = (*ScaleProcessor)(nil)
+
+// NewScaleProcessor creates a ScaleProcessor for the measure names or patterns.
+func NewScaleProcessor(names []string, factor float64, unit Unit) (*ScaleProcessor, error) {
+	filter, err := Compile(names, ':')
+	if err != nil {
+		return nil, fmt.Errorf("scale processor: %w", err)
+	}
+	return &ScaleProcessor{Filter: filter, Factor: factor, Unit: unit}, nil
+}
+
+func (sp *ScaleProcessor) Apply(measures []Measure) []Measure {
+	for i := range measures {
+		if sp.Filter != nil && !sp.Filter.Match(measures[i].Name) {
+			continue
+		}
+		measures[i].Value = measures[i].Value*sp.Factor + sp.Offset
+		if sp.Unit != "" {
+			measures[i].Type = measures[i].Type.WithUnit(sp.Unit)
+		}
+	}
+	return measures
+}
+
+// DropProcessor drops the measures that match the filter.
+type DropProcessor struct {
+	Filter Filter
+}
+
+var _ Processor = (*DropProcessor)(nil)
+
+func (dp *DropProcessor) Apply(measures []Measure) []Measure {
+	ret := measures[:0]
+	for _, m := range measures {
+		if dp.Filter == nil || !dp.Filter.Match(m.Name) {
+			ret = append(ret, m)
+		}
+	}
+	return ret
+}
+
+// LabelProcessor adds the labels to the measures that match the filter,
+// the existing labels of a measure are not overwritten.
+type LabelProcessor struct {
+	Filter Filter // nil matches all measures
+	Labels Labels
+}
+
+var _ Processor = (*LabelProcessor)(nil)
+
+func (lp *LabelProcessor) Apply(measures []Measure) []Measure {
+	for i := range measures {
+		if lp.Filter != nil && !lp.Filter.Match(measures[i].Name) {
+			continue
+		}
+		labels := make(Labels, len(measures[i].Labels)+len(lp.Labels))
+		for k, v := range lp.Labels {
+			labels[k] = v
+		}
+		for k, v := range measures[i].Labels {
+			labels[k] = v
+		}
+		measures[i].Labels = labels
+	}
+	return measures
+}
@@ -0,0 +1,85 @@
+package metric
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessors(t *testing.T) {
+	rename, err := NewRenameProcessor(`^mem:(.*)_bytes$`, "mem:$1")
+	require.NoError(t, err)
+	scale, err := NewScaleProcessor([]string{"mem:*"}, 1.0/1024, UnitScalar)
+	require.NoError(t, err)
+	drop := &DropProcessor{Filter: MustCompile([]string{"debug:*"}, ':')}
+	label := &LabelProcessor{Labels: Labels{"host": "a"}}
+
+	measures := []Measure{
+		{Name: "mem:used_bytes", Value: 2048, Type: GaugeType(UnitBytes)},
+		{Name: "debug:trace", Value: 1, Type: CounterType(UnitShort)},
+		{Name: "cpu:percent", Labels: Labels{"host": "b"}, Value: 50, Type: GaugeType(UnitPercent)},
+	}
+	for _, p := range []Processor{rename, scale, drop, label} {
+		measures = p.Apply(measures)
+	}
+	require.Len(t, measures, 2)
+	require.Equal(t, "mem:used", measures[0].Name)
+	require.Equal(t, 2.0, measures[0].Value)
+	require.Equal(t, UnitScalar, measures[0].Type.Unit())
+	require.Equal(t, "gauge", measures[0].Type.Name())
+	require.Equal(t, Labels{"host": "a"}, measures[0].Labels)
+	require.Equal(t, 50.0, measures[1].Value)
+	require.Equal(t, Labels{"host": "b"}, measures[1].Labels)
+
+	_, err = NewRenameProcessor(`(`, "")
+	require.Error(t, err)
+}
+
+func TestCollectorProcessors(t *testing.T) {
+	seriesID, err := NewSeriesID("PROC_1M", "1m/1s", time.Second, 60)
+	require.NoError(t, err)
+	// duplicate each measure into a total
+	total := ProcessorFunc(func(measures []Measure) []Measure {
+		sum := 0.0
+		for _, m := range measures {
+			sum += m.Value
+		}
+		return append(measures, Measure{Name: "disk:total", Value: sum, Type: GaugeType(UnitBytes)})
+	})
+	c := NewCollector(WithSeries(seriesID), WithProcessors(total),
+		WithTimeseriesFilter(MustCompile([]string{"disk:*"}, ':')))
+	c.receive(&Gather{measures: []Measure{
+		{Name: "disk:a", Value: 1, Type: GaugeType(UnitBytes)},
+		{Name: "disk:b", Value: 2, Type: GaugeType(UnitBytes)},
+	}})
+	require.ElementsMatch(t, []string{"disk:a", "disk:b", "disk:total"}, c.MetricNames())
+
+	rename, err := NewRenameProcessor(`^disk:`, "storage:")
+	require.NoError(t, err)
+	c.AddProcessor(rename)
+	c.receive(&Gather{measures: []Measure{{Name: "disk:c", Value: 3, Type: GaugeType(UnitBytes)}}})
+	// renamed measures are filtered out
+	require.Len(t, c.MetricNames(), 3)
+
+	sn, err := c.Inflight("disk:total")
+	require.NoError(t, err)
+	require.Equal(t, 3.0, sn["PROC_1M"].Value.(*GaugeValue).Value)
+	c.Stop()
+}
+
+func TestProcessorsKeepSentMeasures(t *testing.T) {
+	rename, err := NewRenameProcessor(`^disk:`, "storage:")
+	require.NoError(t, err)
+	c := NewCollector(WithProcessors(rename, &DropProcessor{Filter: MustCompile([]string{"storage:a"}, ':')}))
+	defer c.Stop()
+	sent := []Measure{
+		{Name: "disk:a", Value: 1, Type: GaugeType(UnitBytes)},
+		{Name: "disk:b", Value: 2, Type: GaugeType(UnitBytes)},
+	}
+	c.receive(&Gather{measures: sent})
+	require.Equal(t, []string{"storage:b"}, c.MetricNames())
+	// the measures of the caller, e.g. of Send(), are not modified
+	require.Equal(t, "disk:a", sent[0].Name)
+	require.Equal(t, "disk:b", sent[1].Name)
+}
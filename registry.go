@@ -0,0 +1,164 @@
+package metric
+
+import (
+	"expvar"
+	"log/slog"
+	"slices"
+	"sync"
+)
+
+// Registry is where the collector publishes its time series by the publish names.
+type Registry interface {
+	// Publish adds or replaces the variable of the name.
+	Publish(name string, v expvar.Var)
+	// Unpublish removes the variable of the name.
+	Unpublish(name string)
+	// Get returns the variable of the name, or nil if it does not exist.
+	Get(name string) expvar.Var
+	// Do calls f for each variable in the order of the names.
+	Do(f func(name string, v expvar.Var))
+}
+
+// MemoryRegistry is a Registry isolated from other collectors,
+// it is the default registry of the collector.
+type MemoryRegistry struct {
+	mu   sync.RWMutex
+	vars map[string]expvar.Var
+}
+
+var _ Registry = (*MemoryRegistry)(nil)
+
+func NewRegistry() *MemoryRegistry {
+	return &MemoryRegistry{vars: make(map[string]expvar.Var)}
+}
+
+func (r *MemoryRegistry) Publish(name string, v expvar.Var) {
+	r.mu.Lock()
+	r.vars[name] = v
+	r.mu.Unlock()
+}
+
+func (r *MemoryRegistry) Unpublish(name string) {
+	r.mu.Lock()
+	delete(r.vars, name)
+	r.mu.Unlock()
+}
+
+func (r *MemoryRegistry) Get(name string) expvar.Var {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.vars[name]
+}
+
+func (r *MemoryRegistry) Do(f func(name string, v expvar.Var)) {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.vars))
+	for name := range r.vars {
+		names = append(names, name)
+	}
+	r.mu.RUnlock()
+	slices.Sort(names)
+	for _, name := range names {
+		if v := r.Get(name); v != nil {
+			f(name, v)
+		}
+	}
+}
+
+// ExpvarRegistry publishes the time series to the expvar package,
+// so that they are served by the "/debug/vars" handler.
+//
+// expvar panics on duplicate names and does not support removing a variable,
+// so each name is published once with a slot that holds the variable.
+// Publishing the name again replaces the variable in the slot,
+// and unpublishing leaves the slot empty which is shown as null.
+// A name published to expvar outside of the registry is not replaced, but logged as an error.
+type ExpvarRegistry struct{}
+
+var _ Registry = ExpvarRegistry{}
+
+func NewExpvarRegistry() ExpvarRegistry {
+	return ExpvarRegistry{}
+}
+
+// expvarSlots holds the slots published to expvar, which are shared by all ExpvarRegistry.
+var expvarSlots = struct {
+	sync.Mutex
+	slots map[string]*expvarSlot
+}{slots: make(map[string]*expvarSlot)}
+
+type expvarSlot struct {
+	mu sync.Mutex
+	v  expvar.Var
+}
+
+func (s *expvarSlot) String() string {
+	v := s.get()
+	if v == nil {
+		return "null"
+	}
+	return v.String()
+}
+
+func (s *expvarSlot) get() expvar.Var {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.v
+}
+
+func (s *expvarSlot) set(v expvar.Var) {
+	s.mu.Lock()
+	s.v = v
+	s.mu.Unlock()
+}
+
+func (ExpvarRegistry) Publish(name string, v expvar.Var) {
+	expvarSlots.Lock()
+	defer expvarSlots.Unlock()
+	if slot, ok := expvarSlots.slots[name]; ok {
+		slot.set(v)
+		return
+	}
+	if expvar.Get(name) != nil {
+		slog.Error("Error publishing to expvar, the name is taken", "name", name)
+		return
+	}
+	slot := &expvarSlot{v: v}
+	expvarSlots.slots[name] = slot
+	expvar.Publish(name, slot)
+}
+
+func (ExpvarRegistry) Unpublish(name string) {
+	expvarSlots.Lock()
+	defer expvarSlots.Unlock()
+	if slot, ok := expvarSlots.slots[name]; ok {
+		slot.set(nil)
+	}
+}
+
+func (ExpvarRegistry) Get(name string) expvar.Var {
+	expvarSlots.Lock()
+	slot, ok := expvarSlots.slots[name]
+	expvarSlots.Unlock()
+	if !ok {
+		return nil
+	}
+	return slot.get()
+}
+
+// Do calls f for each variable published by the ExpvarRegistry,
+// other variables of expvar are not included.
+func (r ExpvarRegistry) Do(f func(name string, v expvar.Var)) {
+	expvarSlots.Lock()
+	names := make([]string, 0, len(expvarSlots.slots))
+	for name := range expvarSlots.slots {
+		names = append(names, name)
+	}
+	expvarSlots.Unlock()
+	slices.Sort(names)
+	for _, name := range names {
+		if v := r.Get(name); v != nil {
+			f(name, v)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package metric
+
+import (
+	"expvar"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryRegistry(t *testing.T) {
+	r := NewRegistry()
+	r.Publish("b", expvar.Func(func() any { return 2 }))
+	r.Publish("a", expvar.Func(func() any { return 1 }))
+	require.Equal(t, "1", r.Get("a").String())
+
+	var names []string
+	r.Do(func(name string, v expvar.Var) { names = append(names, name) })
+	require.Equal(t, []string{"a", "b"}, names)
+
+	r.Unpublish("a")
+	require.Nil(t, r.Get("a"))
+	// not published to expvar
+	require.Nil(t, expvar.Get("a"))
+}
+
+func TestExpvarRegistry(t *testing.T) {
+	r := NewExpvarRegistry()
+	r.Publish("registry_test:a", expvar.Func(func() any { return 1 }))
+	require.Equal(t, "1", expvar.Get("registry_test:a").String())
+
+	// publishing the same name again does not panic
+	r.Publish("registry_test:a", expvar.Func(func() any { return 2 }))
+	require.Equal(t, "2", expvar.Get("registry_test:a").String())
+
+	r.Unpublish("registry_test:a")
+	require.Nil(t, r.Get("registry_test:a"))
+	require.Equal(t, "null", expvar.Get("registry_test:a").String())
+
+	// a name published outside of the registry is kept
+	expvar.Publish("registry_test:b", expvar.Func(func() any { return 1 }))
+	r.Publish("registry_test:b", expvar.Func(func() any { return 2 }))
+	require.Nil(t, r.Get("registry_test:b"))
+	require.Equal(t, "1", expvar.Get("registry_test:b").String())
+}
+
+func TestCollectorRegistry(t *testing.T) {
+	seriesID, err := NewSeriesID("REG_1M", "1m/1s", time.Second, 60)
+	require.NoError(t, err)
+	// two collectors with the same prefix do not conflict
+	for _, r := range []Registry{nil, nil, NewExpvarRegistry(), NewExpvarRegistry()} {
+		opts := []CollectorOption{WithSeries(seriesID), WithPrefix("reg")}
+		if r != nil {
+			opts = append(opts, WithRegistry(r))
+		}
+		c := NewCollector(opts...)
+		c.receive(&Gather{measures: []Measure{{Name: "cpu", Value: 1, Type: GaugeType(UnitPercent)}}})
+		require.NotNil(t, c.Registry().Get("reg:cpu"))
+		c.Stop()
+	}
+	require.NotNil(t, expvar.Get("reg:cpu"))
+}
@@ -0,0 +1,356 @@
+package metric
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+)
+
+// Sketch is a DDSketch, a quantile sketch with a relative-error guarantee:
+// a quantile it returns is within RelativeAccuracy of the exact value,
+// e.g. 0.01 means within 1%. Two sketches of the same accuracy merge exactly,
+// so the quantiles of merged bins are as accurate as the ones of a single bin.
+//
+// The values are counted in logarithmic buckets, the positive and the negative values separately.
+// If the number of buckets of a sign exceeds MaxBuckets, the lowest buckets are collapsed,
+// which loses the accuracy of the smallest magnitudes first.
+type Sketch struct {
+	RelativeAccuracy float64     `json:"accuracy"`
+	MaxBuckets       int         `json:"max_buckets"`
+	Count            float64     `json:"count"`
+	Sum              float64     `json:"sum"`
+	Min              float64     `json:"min"`
+	Max              float64     `json:"max"`
+	Zeros            float64     `json:"zeros,omitempty"`
+	Positive         sketchStore `json:"positive"`
+	Negative         sketchStore `json:"negative"`
+
+	gamma    float64
+	logGamma float64
+}
+
+// sketchStore is the counts of the contiguous buckets from the index Offset.
+type sketchStore struct {
+	Offset int       `json:"offset"`
+	Counts []float64 `json:"counts,omitempty"`
+}
+
+// the smallest magnitude that is not counted as zero
+const sketchMinIndexable = 1e-9
+
+// NewSketch returns a Sketch of the relative accuracy, in the range (0, 1).
+// The memory is bounded by 2048 buckets per sign, which covers values
+// from 1e-9 to 1e9 at 1% of accuracy.
+func NewSketch(relativeAccuracy float64) *Sketch {
+	if relativeAccuracy <= 0 || relativeAccuracy >= 1 {
+		relativeAccuracy = 0.01
+	}
+	s := &Sketch{RelativeAccuracy: relativeAccuracy, MaxBuckets: 2048}
+	s.init()
+	return s
+}
+
+func (s *Sketch) init() {
+	s.gamma = (1 + s.RelativeAccuracy) / (1 - s.RelativeAccuracy)
+	s.logGamma = math.Log(s.gamma)
+}
+
+func (s *Sketch) UnmarshalJSON(data []byte) error {
+	type sketch Sketch
+	var obj sketch
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	if obj.RelativeAccuracy <= 0 || obj.RelativeAccuracy >= 1 {
+		return fmt.Errorf("sketch: invalid relative accuracy %v", obj.RelativeAccuracy)
+	}
+	*s = Sketch(obj)
+	s.init()
+	return nil
+}
+
+func (s *Sketch) index(v float64) int {
+	return int(math.Ceil(math.Log(v) / s.logGamma))
+}
+
+func (s *Sketch) value(index int) float64 {
+	return 2 * math.Pow(s.gamma, float64(index)) / (s.gamma + 1)
+}
+
+// Add adds a value to the sketch.
+func (s *Sketch) Add(v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+	if s.Count == 0 {
+		s.Min, s.Max = v, v
+	} else {
+		s.Min, s.Max = min(s.Min, v), max(s.Max, v)
+	}
+	s.Count++
+	s.Sum += v
+	switch {
+	case v > sketchMinIndexable:
+		s.Positive.add(s.index(v), 1, s.MaxBuckets)
+	case v < -sketchMinIndexable:
+		s.Negative.add(s.index(-v), 1, s.MaxBuckets)
+	default:
+		s.Zeros++
+	}
+}
+
+// Merge adds the counts of the other sketch, which should have the same relative accuracy.
+func (s *Sketch) Merge(o *Sketch) error {
+	if o == nil || o.Count == 0 {
+		return nil
+	}
+	if o.RelativeAccuracy != s.RelativeAccuracy {
+		return fmt.Errorf("%w: sketch of accuracy %v into %v", ErrNotMergeable, o.RelativeAccuracy, s.RelativeAccuracy)
+	}
+	if s.Count == 0 {
+		s.Min, s.Max = o.Min, o.Max
+	} else {
+		s.Min, s.Max = min(s.Min, o.Min), max(s.Max, o.Max)
+	}
+	s.Count += o.Count
+	s.Sum += o.Sum
+	s.Zeros += o.Zeros
+	for i, c := range o.Positive.Counts {
+		if c > 0 {
+			s.Positive.add(o.Positive.Offset+i, c, s.MaxBuckets)
+		}
+	}
+	for i, c := range o.Negative.Counts {
+		if c > 0 {
+			s.Negative.add(o.Negative.Offset+i, c, s.MaxBuckets)
+		}
+	}
+	return nil
+}
+
+// Quantile returns the value of the quantile q in [0, 1], or NaN if the sketch is empty.
+func (s *Sketch) Quantile(q float64) float64 {
+	if s.Count == 0 || q < 0 || q > 1 {
+		return math.NaN()
+	}
+	rank := q * (s.Count - 1)
+	var v float64
+	var cum float64
+	found := false
+	// from the most negative value, which is the highest index of the negative store
+	for i := len(s.Negative.Counts) - 1; i >= 0 && !found; i-- {
+		cum += s.Negative.Counts[i]
+		if cum > rank {
+			v, found = -s.value(s.Negative.Offset+i), true
+		}
+	}
+	if !found {
+		cum += s.Zeros
+		if cum > rank {
+			v, found = 0, true
+		}
+	}
+	for i := 0; i < len(s.Positive.Counts) && !found; i++ {
+		cum += s.Positive.Counts[i]
+		if cum > rank {
+			v, found = s.value(s.Positive.Offset+i), true
+		}
+	}
+	if !found {
+		v = s.Max
+	}
+	return min(max(v, s.Min), s.Max)
+}
+
+// buckets calls fn with the value and the count of each non-empty bucket in ascending order.
+func (s *Sketch) buckets(fn func(value float64, count float64)) {
+	for i := len(s.Negative.Counts) - 1; i >= 0; i-- {
+		if c := s.Negative.Counts[i]; c > 0 {
+			fn(-s.value(s.Negative.Offset+i), c)
+		}
+	}
+	if s.Zeros > 0 {
+		fn(0, s.Zeros)
+	}
+	for i, c := range s.Positive.Counts {
+		if c > 0 {
+			fn(s.value(s.Positive.Offset+i), c)
+		}
+	}
+}
+
+// Clone returns a deep copy of the sketch.
+func (s *Sketch) Clone() *Sketch {
+	ret := *s
+	ret.Positive.Counts = append([]float64(nil), s.Positive.Counts...)
+	ret.Negative.Counts = append([]float64(nil), s.Negative.Counts...)
+	return &ret
+}
+
+// Reset removes all values from the sketch.
+func (s *Sketch) Reset() {
+	s.Count, s.Sum, s.Min, s.Max, s.Zeros = 0, 0, 0, 0, 0
+	s.Positive = sketchStore{}
+	s.Negative = sketchStore{}
+}
+
+func (ss *sketchStore) add(index int, count float64, maxBuckets int) {
+	if len(ss.Counts) == 0 {
+		ss.Offset = index
+		ss.Counts = append(ss.Counts, count)
+		return
+	}
+	if index < ss.Offset {
+		if maxBuckets > 0 && ss.Offset+len(ss.Counts)-index > maxBuckets {
+			// lower than the collapsed buckets
+			ss.Counts[0] += count
+			return
+		}
+		grow := ss.Offset - index
+		ss.Counts = append(make([]float64, grow, grow+len(ss.Counts)), ss.Counts...)
+		ss.Offset = index
+	} else if end := ss.Offset + len(ss.Counts); index >= end {
+		ss.Counts = append(ss.Counts, make([]float64, index-end+1)...)
+	}
+	ss.Counts[index-ss.Offset] += count
+	ss.collapse(maxBuckets)
+}
+
+// collapse merges the lowest buckets so that the store has at most maxBuckets.
+func (ss *sketchStore) collapse(maxBuckets int) {
+	if maxBuckets <= 0 || len(ss.Counts) <= maxBuckets {
+		return
+	}
+	n := len(ss.Counts) - maxBuckets
+	var sum float64
+	for _, c := range ss.Counts[:n+1] {
+		sum += c
+	}
+	ss.Counts = ss.Counts[n:]
+	ss.Counts[0] = sum
+	ss.Offset += n
+}
+
+// SketchHistogram is a histogram Producer backed by a Sketch.
+// Unlike Histogram, its HistogramValue carries the sketch,
+// so the rollups and the derivers compute the percentiles of the merged bins exactly
+// within the relative accuracy.
+type SketchHistogram struct {
+	sync.Mutex
+	sketch   *Sketch
+	qs       []float64
+	derivers []Deriver
+}
+
+var _ Producer = (*SketchHistogram)(nil)
+var _ Merger = (*SketchHistogram)(nil)
+
+// NewSketchHistogram returns a SketchHistogram that produces the percentiles qs,
+// default is p50, p90 and p99.
+func NewSketchHistogram(relativeAccuracy float64, qs ...float64) *SketchHistogram {
+	h := &SketchHistogram{
+		sketch: NewSketch(relativeAccuracy),
+		qs:     []float64{0.5, 0.90, 0.99},
+	}
+	if len(qs) > 0 {
+		h.qs = qs
+	}
+	return h
+}
+
+func (h *SketchHistogram) WithDerivers(derivers ...Deriver) *SketchHistogram {
+	h.derivers = append(h.derivers, derivers...)
+	return h
+}
+
+func (h *SketchHistogram) Derivers() []Deriver {
+	return h.derivers
+}
+
+func (h *SketchHistogram) Add(v float64) {
+	h.Lock()
+	defer h.Unlock()
+	h.sketch.Add(v)
+}
+
+// Merge merges the sketch of the HistogramValue.
+func (h *SketchHistogram) Merge(v Value) error {
+	hv, ok := v.(*HistogramValue)
+	if !ok {
+		return fmt.Errorf("%w: %T into sketch histogram", ErrNotMergeable, v)
+	}
+	if hv.Samples == 0 {
+		return nil
+	}
+	if hv.Sketch == nil {
+		return fmt.Errorf("%w: histogram value without sketch", ErrNotMergeable)
+	}
+	h.Lock()
+	defer h.Unlock()
+	return h.sketch.Merge(hv.Sketch)
+}
+
+// Quantile returns the value of the quantile q in [0, 1].
+func (h *SketchHistogram) Quantile(q float64) float64 {
+	h.Lock()
+	defer h.Unlock()
+	return h.sketch.Quantile(q)
+}
+
+func (h *SketchHistogram) Produce(reset bool) Value {
+	h.Lock()
+	defer h.Unlock()
+	ret := &HistogramValue{
+		Samples: int64(h.sketch.Count),
+		P:       h.qs,
+		Values:  sketchQuantiles(h.sketch, h.qs),
+	}
+	if h.sketch.Count > 0 {
+		ret.Sketch = h.sketch.Clone()
+	}
+	if reset {
+		h.sketch.Reset()
+	}
+	return ret
+}
+
+func sketchQuantiles(s *Sketch, qs []float64) []float64 {
+	ret := make([]float64, len(qs))
+	if s.Count == 0 {
+		return ret
+	}
+	for i, q := range qs {
+		ret[i] = s.Quantile(q)
+	}
+	return ret
+}
+
+func (h *SketchHistogram) String() string {
+	return h.Produce(false).String()
+}
+
+func (h *SketchHistogram) MarshalJSON() ([]byte, error) {
+	h.Lock()
+	defer h.Unlock()
+	return json.Marshal(map[string]any{
+		"qs":     h.qs,
+		"sketch": h.sketch,
+	})
+}
+
+func (h *SketchHistogram) UnmarshalJSON(data []byte) error {
+	var obj struct {
+		Qs     []float64 `json:"qs"`
+		Sketch *Sketch   `json:"sketch"`
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	if obj.Sketch == nil {
+		return fmt.Errorf("sketch histogram: no sketch")
+	}
+	h.qs = obj.Qs
+	h.sketch = obj.Sketch
+	return nil
+}
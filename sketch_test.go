@@ -0,0 +1,129 @@
+package metric
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func requireRelative(t *testing.T, expected, actual, accuracy float64, msgAndArgs ...any) {
+	t.Helper()
+	require.LessOrEqual(t, math.Abs(actual-expected), math.Abs(expected)*accuracy+1e-9, msgAndArgs...)
+}
+
+func TestSketch(t *testing.T) {
+	s := NewSketch(0.01)
+	for i := 1; i <= 1000; i++ {
+		s.Add(float64(i))
+	}
+	require.Equal(t, 1000.0, s.Count)
+	require.Equal(t, 1.0, s.Quantile(0))
+	require.Equal(t, 1000.0, s.Quantile(1))
+	for _, q := range []float64{0.5, 0.9, 0.99, 0.999} {
+		requireRelative(t, math.Round(q*999)+1, s.Quantile(q), 0.01, "q=%v", q)
+	}
+	require.True(t, math.IsNaN(NewSketch(0.01).Quantile(0.5)))
+
+	// negative values and zeros
+	s = NewSketch(0.01)
+	for _, v := range []float64{-100, -10, 0, 0, 10, 100} {
+		s.Add(v)
+	}
+	require.Equal(t, -100.0, s.Quantile(0))
+	requireRelative(t, -10, s.Quantile(0.2), 0.01)
+	require.Equal(t, 0.0, s.Quantile(0.5))
+	requireRelative(t, 10, s.Quantile(0.8), 0.01)
+}
+
+func TestSketchMerge(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	var all []float64
+	merged := NewSketch(0.02)
+	for range 10 {
+		part := NewSketch(0.02)
+		for range 500 {
+			v := r.ExpFloat64() * 100
+			all = append(all, v)
+			part.Add(v)
+		}
+		require.NoError(t, merged.Merge(part))
+	}
+	slices.Sort(all)
+	for _, q := range []float64{0.5, 0.9, 0.99} {
+		exact := all[int(q*float64(len(all)-1))]
+		requireRelative(t, exact, merged.Quantile(q), 0.02, "q=%v", q)
+	}
+	// an empty sketch is ignored
+	require.NoError(t, merged.Merge(NewSketch(0.01)))
+	other := NewSketch(0.01)
+	other.Add(1)
+	require.ErrorIs(t, merged.Merge(other), ErrNotMergeable)
+}
+
+func TestSketchCollapse(t *testing.T) {
+	s := NewSketch(0.01)
+	s.MaxBuckets = 10
+	for i := 1; i <= 1000; i++ {
+		s.Add(float64(i))
+	}
+	require.Len(t, s.Positive.Counts, 10)
+	require.Equal(t, 1000.0, s.Count)
+	// the high quantiles keep the accuracy
+	requireRelative(t, 990, s.Quantile(0.99), 0.01)
+}
+
+func TestSketchHistogram(t *testing.T) {
+	h := NewSketchHistogram(0.01, 0.5, 0.99)
+	for i := 1; i <= 100; i++ {
+		h.Add(float64(i))
+	}
+	v := h.Produce(true).(*HistogramValue)
+	require.Equal(t, int64(100), v.Samples)
+	require.Equal(t, []float64{0.5, 0.99}, v.P)
+	requireRelative(t, 50, v.Values[0], 0.01)
+	requireRelative(t, 99, v.Values[1], 0.01)
+	require.NotNil(t, v.Sketch)
+	require.Equal(t, int64(0), h.Produce(false).(*HistogramValue).Samples)
+
+	// serialized in the HistogramValue
+	b, err := json.Marshal(v)
+	require.NoError(t, err)
+	var v2 HistogramValue
+	require.NoError(t, json.Unmarshal(b, &v2))
+	require.Equal(t, v.Sketch.Quantile(0.9), v2.Sketch.Quantile(0.9))
+
+	// merges exactly
+	for i := 101; i <= 200; i++ {
+		h.Add(float64(i))
+	}
+	require.NoError(t, h.Merge(&v2))
+	requireRelative(t, 100, h.Quantile(0.5), 0.01)
+	requireRelative(t, 198, h.Quantile(0.99), 0.01)
+	require.ErrorIs(t, h.Merge(&HistogramValue{Samples: 1, P: []float64{0.5}, Values: []float64{1}}), ErrNotMergeable)
+
+	// producer JSON
+	b, err = json.Marshal(h)
+	require.NoError(t, err)
+	var h2 SketchHistogram
+	require.NoError(t, json.Unmarshal(b, &h2))
+	require.Equal(t, h.Quantile(0.9), h2.Quantile(0.9))
+}
+
+func TestSketchHistogramMovingAverage(t *testing.T) {
+	var values []Value
+	for w := range 3 {
+		h := NewSketchHistogram(0.01, 0.5)
+		for i := 1; i <= 100; i++ {
+			h.Add(float64(w*100 + i))
+		}
+		values = append(values, h.Produce(true))
+	}
+	// percentiles of the window instead of the averages of the percentiles
+	ret := NewMovingAverage("ma3", 3).Derive(values).(*HistogramValue)
+	require.Equal(t, int64(300), ret.Samples)
+	requireRelative(t, 150, ret.Values[0], 0.01)
+}
@@ -97,8 +97,13 @@ func (id SeriesID) MaxCount() int {
 	return id.maxCount
 }
 
+// OldestTime returns the time of the oldest bin of the series at the current time.
 func (id SeriesID) OldestTime() time.Time {
-	now := time.Now()
+	return id.OldestTimeAt(time.Now())
+}
+
+// OldestTimeAt returns the time of the oldest bin of the series at now.
+func (id SeriesID) OldestTimeAt(now time.Time) time.Time {
 	now = now.Add(id.period / 2).Round(id.period)
 	return now.Add(-id.period * time.Duration(id.maxCount))
 }
@@ -110,24 +115,40 @@ type Storage interface {
 	Store(id SeriesID, pd Product, closing bool) error
 
 	// Load retrieves up to maxCount of the most recent Products for the given seriesId.
+	// The metricName is the series key, which is the measure name with its labels.
 	// If no Products are found, returns (nil, nil).
 	Load(id SeriesID, metricName string) ([]Product, error)
 }
 
-func NewFileStorage(dir string, bufferSize int) *FileStorage {
+type FileStorageOption func(*FileStorage)
+
+// FileStorageClock sets the clock that decides the time range of the Products to keep.
+// Default is SystemClock().
+func FileStorageClock(clock Clock) FileStorageOption {
+	return func(ds *FileStorage) {
+		ds.clock = clock
+	}
+}
+
+func NewFileStorage(dir string, bufferSize int, opts ...FileStorageOption) *FileStorage {
 	if dir == "" {
 		return nil
 	}
 	if bufferSize <= 0 {
 		bufferSize = 100
 	}
-	return &FileStorage{
+	ds := &FileStorage{
 		dir:                     dir,
 		wChan:                   make(chan *FileRecord, bufferSize),
 		closeChan:               make(chan interface{}),
 		files:                   make(map[string]*FileHandle),
 		shrinkThresholdDuration: time.Minute,
+		clock:                   SystemClock(),
 	}
+	for _, opt := range opts {
+		opt(ds)
+	}
+	return ds
 }
 
 var _ Storage = (*FileStorage)(nil)
@@ -139,6 +160,7 @@ type FileStorage struct {
 	files     map[string]*FileHandle
 
 	shrinkThresholdDuration time.Duration
+	clock                   Clock
 }
 
 type FileRecord struct {
@@ -235,7 +257,7 @@ func (ds *FileStorage) write(id SeriesID, pd Product, closing bool) error {
 			slog.Error("Failed to open file for writing", "file", path, "error", err)
 			return err
 		}
-		h = &FileHandle{file: f, path: path, lastShrinkTime: time.Now()}
+		h = &FileHandle{file: f, path: path, lastShrinkTime: ds.clock.Now()}
 		ds.files[id.ID()] = h
 	}
 
@@ -255,11 +277,11 @@ func (ds *FileStorage) write(id SeriesID, pd Product, closing bool) error {
 		return nil
 	}
 
-	if time.Since(h.lastShrinkTime) < ds.shrinkThresholdDuration {
+	if ds.clock.Now().Sub(h.lastShrinkTime) < ds.shrinkThresholdDuration {
 		return nil
 	}
 	h.lastAppendCount = 0
-	h.lastShrinkTime = time.Now()
+	h.lastShrinkTime = ds.clock.Now()
 
 	// close current file before shrinking
 	h.file.Close()
@@ -276,7 +298,7 @@ func (ds *FileStorage) write(id SeriesID, pd Product, closing bool) error {
 	// find the offset to keep only the last maxCount lines
 	// that are within the time range of maxCount * period
 	// by checking the timestamp of each line
-	timeThreshold := id.OldestTime()
+	timeThreshold := id.OldestTimeAt(ds.clock.Now())
 	for i, line := range lines {
 		prd := Product{}
 		if err := parseProduct(&prd, line, false); err != nil {
@@ -309,7 +331,7 @@ func (ds *FileStorage) Load(id SeriesID, name string) ([]Product, error) {
 		return nil, err
 	}
 	lines := strings.Split(strings.TrimRight(string(b), "\n"), "\n")
-	timeThreshold := id.OldestTime()
+	timeThreshold := id.OldestTimeAt(ds.clock.Now())
 
 	products := make([]Product, 0, id.MaxCount())
 	for _, line := range lines {
@@ -318,7 +340,7 @@ func (ds *FileStorage) Load(id SeriesID, name string) ([]Product, error) {
 			slog.Warn("Failed to parse product", "line", line, "error", err)
 			continue
 		}
-		if pd.Name != name {
+		if pd.Key() != name {
 			continue
 		}
 		if pd.Time.Before(timeThreshold) {
@@ -332,6 +354,7 @@ func (ds *FileStorage) Load(id SeriesID, name string) ([]Product, error) {
 func parseProduct(pd *Product, line string, includeValue bool) error {
 	obj := struct {
 		Name        string         `json:"name"`
+		Labels      Labels         `json:"labels"`
 		Time        time.Time      `json:"ts"`
 		Value       map[string]any `json:"value"`
 		SeriesID    string         `json:"series_id"`
@@ -346,6 +369,7 @@ func parseProduct(pd *Product, line string, includeValue bool) error {
 	}
 	*pd = Product{
 		Name:        obj.Name,
+		Labels:      obj.Labels,
 		Time:        obj.Time,
 		Value:       nil,
 		SeriesID:    obj.SeriesID,
@@ -399,6 +423,18 @@ func parseProduct(pd *Product, line string, includeValue bool) error {
 			return err
 		}
 		pd.Value = &v
+	case "bucket_histogram":
+		var v BucketHistogramValue
+		if err := json.Unmarshal(b, &v); err != nil {
+			return err
+		}
+		pd.Value = &v
+	case "unique":
+		var v UniqueValue
+		if err := json.Unmarshal(b, &v); err != nil {
+			return err
+		}
+		pd.Value = &v
 	default:
 		return fmt.Errorf("unknown product type %q", obj.Type)
 	}
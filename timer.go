@@ -2,6 +2,7 @@ package metric
 
 import (
 	"encoding/json"
+	"fmt"
 	"sync"
 	"time"
 )
@@ -88,6 +89,27 @@ func (t *Timer) Produce(reset bool) Value {
 	return ret
 }
 
+func (t *Timer) Merge(v Value) error {
+	tv, ok := v.(*TimerValue)
+	if !ok {
+		return fmt.Errorf("%w: %T into timer", ErrNotMergeable, v)
+	}
+	if tv.Samples == 0 {
+		return nil
+	}
+	t.Lock()
+	defer t.Unlock()
+	if t.samples == 0 {
+		t.minDuration = tv.Min
+		t.maxDuration = tv.Max
+	}
+	t.minDuration = min(t.minDuration, tv.Min)
+	t.maxDuration = max(t.maxDuration, tv.Max)
+	t.sumDuration += tv.Sum
+	t.samples += tv.Samples
+	return nil
+}
+
 type TimerMarker struct {
 	t     *Timer
 	start time.Time
@@ -100,7 +122,7 @@ func (w *TimerMarker) Mark() {
 }
 
 func (t *Timer) New() Marker {
-	return &TimerMarker{t: t, start: nowFunc()}
+	return &TimerMarker{t: t, start: time.Now()}
 }
 
 func (t *Timer) Add(v float64) {
@@ -130,7 +152,7 @@ type TimerValue struct {
 	Min     time.Duration `json:"min"`
 	Max     time.Duration `json:"max"`
 	// Optional derived values, such as moving averages
-	DerivedValues map[string]Value `json:"derived,omitempty"`
+	DerivedValues DerivedValues `json:"derived,omitempty"`
 }
 
 func (tp TimerValue) String() string {
@@ -140,7 +162,7 @@ func (tp TimerValue) String() string {
 
 func (cp *TimerValue) SetDerivedValue(name string, value Value) {
 	if cp.DerivedValues == nil {
-		cp.DerivedValues = make(map[string]Value)
+		cp.DerivedValues = make(DerivedValues)
 	}
 	cp.DerivedValues[name] = value
 }
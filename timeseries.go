@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"slices"
 	"sync"
 	"time"
 )
@@ -17,9 +18,9 @@ type TimeBin struct {
 
 func (tv TimeBin) String() string {
 	if ((any)(tv.Value)) == nil {
-		return fmt.Sprintf(`{"ts":"%s",isNull:%t}`, tv.Time.In(timeZone).Format(time.DateTime), tv.IsNull)
+		return fmt.Sprintf(`{"ts":"%s",isNull:%t}`, tv.Time.Format(time.DateTime), tv.IsNull)
 	}
-	return fmt.Sprintf(`{"ts":"%s","value":%s}`, tv.Time.In(timeZone).Format(time.DateTime), tv.Value.String())
+	return fmt.Sprintf(`{"ts":"%s","value":%s}`, tv.Time.Format(time.DateTime), tv.Value.String())
 }
 
 func (tv TimeBin) MarshalJSON() ([]byte, error) {
@@ -42,41 +43,63 @@ func (tv *TimeBin) UnmarshalJSON(data []byte) error {
 	if err := json.Unmarshal(data, &obj); err != nil {
 		return err
 	}
-	tv.Time = time.Unix(0, obj.Time).In(timeZone)
+	tv.Time = time.Unix(0, obj.Time)
 	tv.IsNull = obj.IsNull
 	if tv.IsNull {
 		return nil
 	}
-	switch obj.Type {
-	case "*metric.CounterValue":
-		tv.Value = &CounterValue{}
-	case "*metric.GaugeValue":
-		tv.Value = &GaugeValue{}
-	case "*metric.HistogramValue":
-		tv.Value = &HistogramValue{}
-	case "*metric.MeterValue":
-		tv.Value = &MeterValue{}
-	case "*metric.TimerValue":
-		tv.Value = &TimerValue{}
-	case "*metric.OdometerValue":
-		tv.Value = &OdometerValue{}
-	default:
-		return fmt.Errorf("unknown value type %s", obj.Type)
+	value, err := newValue(obj.Type)
+	if err != nil {
+		return err
 	}
 	b, err := json.Marshal(obj.Value)
 	if err != nil {
 		return err
 	}
-	if err := json.Unmarshal(b, tv.Value); err != nil {
+	if err := json.Unmarshal(b, value); err != nil {
 		return err
 	}
+	tv.Value = value
 	return nil
 }
 
+// newValue returns a zero Value of the type name formatted by %T.
+func newValue(typ string) (Value, error) {
+	switch typ {
+	case "*metric.CounterValue":
+		return &CounterValue{}, nil
+	case "*metric.GaugeValue":
+		return &GaugeValue{}, nil
+	case "*metric.HistogramValue":
+		return &HistogramValue{}, nil
+	case "*metric.BucketHistogramValue":
+		return &BucketHistogramValue{}, nil
+	case "*metric.UniqueValue":
+		return &UniqueValue{}, nil
+	case "*metric.MeterValue":
+		return &MeterValue{}, nil
+	case "*metric.TimerValue":
+		return &TimerValue{}, nil
+	case "*metric.OdometerValue":
+		return &OdometerValue{}, nil
+	case "*metric.RateValue":
+		return &RateValue{}, nil
+	case "*metric.BandValue":
+		return &BandValue{}, nil
+	case "*metric.ForecastValue":
+		return &ForecastValue{}, nil
+	case "*metric.AnomalyValue":
+		return &AnomalyValue{}, nil
+	default:
+		return nil, fmt.Errorf("unknown value type %s", typ)
+	}
+}
+
 func ToProduct(tb TimeBin, meta any) Product {
 	if mInfo, ok := meta.(SeriesInfo); ok {
 		return Product{
 			Name:        mInfo.MeasureName,
+			Labels:      mInfo.Labels,
 			Time:        tb.Time,
 			Value:       tb.Value,
 			IsNull:      tb.IsNull,
@@ -122,6 +145,8 @@ type TimeSeries struct {
 	maxCount int
 	meta     any // Optional metadata for the time series
 	lsnr     func(Product)
+	clock    Clock
+	derivers []Deriver // in addition to the ones of the producer
 }
 
 // If aggregator is nil, it will replace the last point with the new one.
@@ -132,6 +157,7 @@ func NewTimeSeries(interval time.Duration, maxCount int, prod Producer, opts ...
 		data:     make([]TimeBin, 0, maxCount),
 		interval: interval,
 		maxCount: maxCount,
+		clock:    SystemClock(),
 	}
 	for _, opt := range opts {
 		opt(ret)
@@ -147,6 +173,21 @@ func WithListener(lsnr func(Product)) TimeSeriesOption {
 	}
 }
 
+// WithTimeSeriesClock sets the clock that gives the time of Add().
+// Default is SystemClock().
+func WithTimeSeriesClock(clock Clock) TimeSeriesOption {
+	return func(ts *TimeSeries) {
+		ts.clock = clock
+	}
+}
+
+// WithTimeSeriesDerivers adds the derivers in addition to the ones of the producer.
+func WithTimeSeriesDerivers(derivers ...Deriver) TimeSeriesOption {
+	return func(ts *TimeSeries) {
+		ts.derivers = append(ts.derivers, derivers...)
+	}
+}
+
 func WithMeta(meta any) TimeSeriesOption {
 	return func(ts *TimeSeries) {
 		ts.meta = meta
@@ -175,7 +216,7 @@ func (ts *TimeSeries) String() string {
 		result += ","
 	}
 	result += fmt.Sprintf(`{"ts":"%s","value":%v}`,
-		ts.roundTime(ts.lastTime).In(timeZone).Format(time.DateTime),
+		ts.roundTime(ts.lastTime).Format(time.DateTime),
 		ts.producer.Produce(false))
 	result += "]"
 	return result
@@ -191,6 +232,9 @@ func (ts *TimeSeries) MaxCount() int {
 
 func (ts *TimeSeries) runDerivers(currentValue Value, preliminary bool) {
 	derivers := ts.producer.Derivers()
+	if len(ts.derivers) > 0 {
+		derivers = slices.Concat(derivers, ts.derivers)
+	}
 	if len(derivers) == 0 {
 		return
 	}
@@ -200,6 +244,11 @@ func (ts *TimeSeries) runDerivers(currentValue Value, preliminary bool) {
 	}
 	// Derive additional values
 	for _, d := range derivers {
+		if inc, ok := d.(IncrementalDeriver); ok {
+			prev := ts.previousDerived(d.ID(), preliminary)
+			driving.SetDerivedValue(d.ID(), inc.DeriveNext(prev, currentValue, ts.interval))
+			continue
+		}
 		var values []Value
 		if ws := d.WindowSize(); ws > 0 {
 			_, values = ts.lastN(d.WindowSize() + 1)
@@ -211,11 +260,34 @@ func (ts *TimeSeries) runDerivers(currentValue Value, preliminary bool) {
 		} else {
 			_, values = ts.lastN(1)
 		}
-		dv := d.Derive(values)
+		var dv Value
+		if id, ok := d.(IntervalDeriver); ok {
+			dv = id.DeriveInterval(values, ts.interval)
+		} else {
+			dv = d.Derive(values)
+		}
 		driving.SetDerivedValue(d.ID(), dv)
 	}
 }
 
+// previousDerived returns the value derived by the deriver of the id on the bin
+// before the current one, which is the producing one if preliminary or the last rolled one.
+func (ts *TimeSeries) previousDerived(id string, preliminary bool) Value {
+	idx := len(ts.data) - 1
+	cur := ts.roundTime(ts.lastTime)
+	if !preliminary {
+		if idx < 0 {
+			return nil
+		}
+		cur = ts.data[idx].Time
+		idx--
+	}
+	if idx < 0 || !ts.data[idx].Time.Equal(cur.Add(-ts.interval)) {
+		return nil
+	}
+	return derivedValues(ts.data[idx].Value)[id]
+}
+
 func (ts *TimeSeries) LastBin() (TimeBin, any) {
 	tm, val := ts.Last()
 	tb := TimeBin{Time: tm, Value: val, IsNull: val == nil}
@@ -312,7 +384,7 @@ func (ts *TimeSeries) After(t time.Time) ([]time.Time, []Value) {
 func (ts *TimeSeries) Add(v float64) {
 	ts.Lock()
 	defer ts.Unlock()
-	ts.add(nowFunc(), v)
+	ts.add(ts.clock.Now(), v)
 }
 
 func (ts *TimeSeries) AddTime(t time.Time, v float64) {
@@ -321,13 +393,54 @@ func (ts *TimeSeries) AddTime(t time.Time, v float64) {
 	ts.add(t, v)
 }
 
+// AddValue merges a Value into the bin of the time t,
+// the producer of the time series should implement Merger.
+// It is used to roll up the finished bins of a finer time series.
+func (ts *TimeSeries) AddValue(t time.Time, v Value) error {
+	merger, ok := ts.producer.(Merger)
+	if !ok {
+		return fmt.Errorf("%w: %T", ErrNotMergeable, ts.producer)
+	}
+	ts.Lock()
+	defer ts.Unlock()
+	ts.roll(t)
+	if v == nil {
+		return nil
+	}
+	return merger.Merge(v)
+}
+
+// AddHashTime adds the hash of a key at the time t,
+// the producer of the time series should implement HashAdder.
+func (ts *TimeSeries) AddHashTime(t time.Time, h uint64) error {
+	adder, ok := ts.producer.(HashAdder)
+	if !ok {
+		return fmt.Errorf("%w: %T", ErrNotHashable, ts.producer)
+	}
+	ts.Lock()
+	defer ts.Unlock()
+	ts.roll(t)
+	adder.AddHash(h)
+	return nil
+}
+
 func (ts *TimeSeries) add(tm time.Time, val float64) {
+	ts.roll(tm)
+	if val == val { // not NaN
+		ts.producer.Add(val)
+	}
+}
+
+// roll moves the time series to the bin of tm,
+// the current bin is finished if tm is in a later bin.
+func (ts *TimeSeries) roll(tm time.Time) {
 	roll := ts.IntervalBetween(ts.lastTime, tm)
 
 	if roll <= 0 || ts.lastTime.IsZero() {
-		ts.lastTime = tm
-		if val == val { // not NaN
-			ts.producer.Add(val)
+		// a late sample, which can come from an input on its own schedule,
+		// goes into the current bin without moving the time backwards.
+		if tm.After(ts.lastTime) {
+			ts.lastTime = tm
 		}
 		return
 	}
@@ -335,22 +448,19 @@ func (ts *TimeSeries) add(tm time.Time, val float64) {
 	p := ts.producer.Produce(true)
 	tb := TimeBin{Time: ts.roundTime(ts.lastTime), Value: p, IsNull: p == nil}
 
-	// Notify listener
-	if ts.lsnr != nil {
-		prd := ToProduct(tb, ts.meta)
-		ts.lsnr(prd)
-	}
-
 	ts.data = append(ts.data, tb)
 	ts.lastTime = tm
-	if val == val { // not NaN
-		ts.producer.Add(val)
-	}
 	roll--
 
 	// Derive additional values
 	ts.runDerivers(tb.Value, false)
 
+	// Notify listener with the derived values
+	if ts.lsnr != nil {
+		prd := ToProduct(tb, ts.meta)
+		ts.lsnr(prd)
+	}
+
 	// Reset if the gap is too large
 	if roll >= ts.maxCount-1 {
 		ts.data = ts.data[:0]
@@ -430,6 +540,15 @@ func (ts *TimeSeries) UnmarshalJSON(data []byte) error {
 	if err := json.Unmarshal(data, &obj); err != nil {
 		return err
 	}
+	// a zero TimeSeries has no clock
+	if ts.clock == nil {
+		ts.clock = SystemClock()
+	}
+	// in the location of the clock
+	loc := ts.clock.Now().Location()
+	for i := range obj.Data {
+		obj.Data[i].Time = obj.Data[i].Time.In(loc)
+	}
 	ts.data = obj.Data
 	if obj.Interval > 0 {
 		ts.interval = time.Duration(obj.Interval)
@@ -437,7 +556,7 @@ func (ts *TimeSeries) UnmarshalJSON(data []byte) error {
 	if obj.MaxCount > 0 {
 		ts.maxCount = obj.MaxCount
 	}
-	ts.lastTime = time.Unix(0, obj.LastTime).In(timeZone)
+	ts.lastTime = time.Unix(0, obj.LastTime).In(loc)
 	var producer Producer
 	switch obj.Type {
 	case "*metric.Meter":
@@ -448,6 +567,12 @@ func (ts *TimeSeries) UnmarshalJSON(data []byte) error {
 		producer = &Gauge{}
 	case "*metric.Histogram":
 		producer = &Histogram{}
+	case "*metric.SketchHistogram":
+		producer = &SketchHistogram{}
+	case "*metric.BucketHistogram":
+		producer = &BucketHistogram{}
+	case "*metric.Unique":
+		producer = &Unique{}
 	case "*metric.Odometer":
 		producer = &Odometer{}
 	default:
@@ -464,6 +589,7 @@ func (ts *TimeSeries) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// Restore loads the stored data of the series key, which is the metric name with its labels.
 func (ts *TimeSeries) Restore(storage Storage, metricName string, series SeriesID) error {
 	if data, err := storage.Load(series, metricName); err != nil {
 		slog.Error("Failed to load time series", "metric", metricName, "series", series.ID(), "error", err)
@@ -494,6 +620,15 @@ func (mts MultiTimeSeries) AddTime(t time.Time, v float64) {
 	}
 }
 
+// info returns the SeriesInfo of the first time series, if any.
+func (mts MultiTimeSeries) info() (SeriesInfo, bool) {
+	if len(mts) == 0 {
+		return SeriesInfo{}, false
+	}
+	nfo, ok := mts[0].Meta().(SeriesInfo)
+	return nfo, ok
+}
+
 func (mts MultiTimeSeries) String() string {
 	if len(mts) == 0 {
 		return "[]"
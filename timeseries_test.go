@@ -1,6 +1,8 @@
 package metric
 
 import (
+	"encoding/json"
+	"math"
 	"testing"
 	"time"
 
@@ -8,9 +10,7 @@ import (
 )
 
 func TestTimeseries(t *testing.T) {
-	now := time.Date(2023, 10, 1, 12, 4, 4, 400_000_000, time.UTC)
-	nowFunc = func() time.Time { return now }
-	timeZone = time.UTC
+	clk := NewFakeClock(time.Date(2023, 10, 1, 12, 4, 4, 400_000_000, time.UTC))
 
 	expectIdx := 0
 	expectProducts := []Product{
@@ -23,10 +23,10 @@ func TestTimeseries(t *testing.T) {
 	ts := NewTimeSeries(time.Second, 3, NewMeter(), WithListener(func(p Product) {
 		require.Equal(t, expectProducts[expectIdx], p, "unexpected product at index %d", expectIdx)
 		expectIdx++
-	}))
+	}), WithTimeSeriesClock(clk))
 	ts.Add(1.0)
 
-	now = now.Add(time.Second)
+	clk.Advance(time.Second)
 	ts.Add(2.0)
 
 	require.JSONEq(t, `[`+
@@ -34,10 +34,10 @@ func TestTimeseries(t *testing.T) {
 		`{"ts":"2023-10-01 12:04:06","value":{"samples":1,"max":2,"min":2,"first":2,"last":2,"sum":2}}`+
 		`]`, ts.String())
 
-	now = now.Add(time.Second)
+	clk.Advance(time.Second)
 	ts.Add(3.0)
 
-	now = now.Add(time.Second)
+	clk.Advance(time.Second)
 	ts.Add(4.0)
 
 	times, values := ts.All()
@@ -52,10 +52,10 @@ func TestTimeseries(t *testing.T) {
 		&MeterValue{Min: 4, Max: 4, First: 4, Last: 4, Sum: 4, Samples: 1},
 	}, values)
 
-	now = now.Add(100 * time.Millisecond)
+	clk.Advance(100 * time.Millisecond)
 	ts.Add(5.0)
 
-	now = now.Add(200 * time.Millisecond)
+	clk.Advance(200 * time.Millisecond)
 	ts.Add(4.8)
 
 	times, values = ts.All()
@@ -70,7 +70,7 @@ func TestTimeseries(t *testing.T) {
 		&MeterValue{Min: 4, Max: 5, First: 4, Last: 4.8, Sum: 13.8, Samples: 3},
 	}, values)
 
-	now = now.Add(1700 * time.Millisecond)
+	clk.Advance(1700 * time.Millisecond)
 	ts.Add(6.0)
 
 	times, values = ts.All()
@@ -85,7 +85,7 @@ func TestTimeseries(t *testing.T) {
 		&MeterValue{Min: 6, Max: 6, First: 6, Last: 6, Sum: 6, Samples: 1},
 	}, values)
 
-	now = now.Add(5 * time.Second)
+	clk.Advance(5 * time.Second)
 	ts.Add(7.0)
 
 	require.JSONEq(t, `[`+
@@ -95,17 +95,12 @@ func TestTimeseries(t *testing.T) {
 }
 
 func TestTimeSeriesSubSeconds(t *testing.T) {
-	ts := NewTimeSeries(time.Second, 10, NewCounter())
-
-	now := time.Date(2023, 10, 1, 12, 4, 5, 0, time.UTC)
-	nowFunc = func() time.Time {
-		ret := now
-		now = now.Add(100 * time.Millisecond)
-		return ret
-	}
+	clk := NewFakeClock(time.Date(2023, 10, 1, 12, 4, 5, 0, time.UTC))
+	ts := NewTimeSeries(time.Second, 10, NewCounter(), WithTimeSeriesClock(clk))
 
 	for i := 1; i <= 10*10; i++ {
 		ts.Add(float64(i))
+		clk.Advance(100 * time.Millisecond)
 	}
 
 	require.JSONEq(t, `[`+
@@ -167,18 +162,16 @@ func TestTimeSeriesSubSeconds(t *testing.T) {
 }
 
 func TestMultiTimeSeries(t *testing.T) {
+	clk := NewFakeClock(time.Date(2023, 10, 1, 12, 4, 5, 0, time.UTC))
 	mts := MultiTimeSeries{
-		NewTimeSeries(time.Second, 10, NewMeter()),
-		NewTimeSeries(10*time.Second, 6, NewMeter()),
-		NewTimeSeries(60*time.Second, 5, NewMeter()),
+		NewTimeSeries(time.Second, 10, NewMeter(), WithTimeSeriesClock(clk)),
+		NewTimeSeries(10*time.Second, 6, NewMeter(), WithTimeSeriesClock(clk)),
+		NewTimeSeries(60*time.Second, 5, NewMeter(), WithTimeSeriesClock(clk)),
 	}
 
-	now := time.Date(2023, 10, 1, 12, 4, 5, 0, time.UTC)
-	nowFunc = func() time.Time { return now }
-
 	for i := 1; i <= 10*5*60; i++ {
 		mts.Add(float64(i))
-		now = now.Add(100 * time.Millisecond)
+		clk.Advance(100 * time.Millisecond)
 	}
 
 	times, values := mts[0].LastN(0)
@@ -243,17 +236,12 @@ func TestMultiTimeSeries(t *testing.T) {
 }
 
 func TestTimeSeriesCounter(t *testing.T) {
-	ts := NewTimeSeries(1*time.Second, 10, NewCounter())
-
-	now := time.Date(2025, 07, 21, 17, 31, 12, 0, time.FixedZone("Asia/Seoul", 9*60*60))
-	nowFunc = func() time.Time {
-		ret := now
-		now = now.Add(time.Millisecond * 100)
-		return ret
-	}
+	clk := NewFakeClock(time.Date(2025, 07, 21, 17, 31, 12, 0, time.FixedZone("Asia/Seoul", 9*60*60)))
+	ts := NewTimeSeries(1*time.Second, 10, NewCounter(), WithTimeSeriesClock(clk))
 
 	for i := 1; i <= 100; i++ {
 		ts.Add(float64(i))
+		clk.Advance(time.Millisecond * 100)
 	}
 
 	times, values := ts.LastN(0)
@@ -284,22 +272,18 @@ func TestTimeSeriesCounter(t *testing.T) {
 }
 
 func TestTimeSeriesCounterWithSlidingWindow(t *testing.T) {
+	clk := NewFakeClock(time.Date(2025, 07, 21, 17, 31, 12, 0, time.FixedZone("Asia/Seoul", 9*60*60)))
 	ts := NewTimeSeries(1*time.Second, 10,
 		NewCounter().WithDerivers(
 			NewMovingAverage("ma3", 3),
 			NewMovingAverage("ma5", 5),
 		),
+		WithTimeSeriesClock(clk),
 	)
 
-	now := time.Date(2025, 07, 21, 17, 31, 12, 0, time.FixedZone("Asia/Seoul", 9*60*60))
-	nowFunc = func() time.Time {
-		ret := now
-		now = now.Add(time.Millisecond * 100)
-		return ret
-	}
-
 	for i := 1; i <= 100; i++ {
 		ts.Add(float64(i))
+		clk.Advance(time.Millisecond * 100)
 	}
 
 	times, values := ts.LastN(0)
@@ -358,17 +342,12 @@ func TestTimeSeriesCounterWithSlidingWindow(t *testing.T) {
 }
 
 func TestTimeSeriesGauge(t *testing.T) {
-	ts := NewTimeSeries(time.Second, 10, NewGauge())
-
-	now := time.Date(2025, 07, 21, 17, 31, 12, 0, time.FixedZone("Asia/Seoul", 9*60*60))
-	nowFunc = func() time.Time {
-		ret := now
-		now = now.Add(time.Millisecond * 100)
-		return ret
-	}
+	clk := NewFakeClock(time.Date(2025, 07, 21, 17, 31, 12, 0, time.FixedZone("Asia/Seoul", 9*60*60)))
+	ts := NewTimeSeries(time.Second, 10, NewGauge(), WithTimeSeriesClock(clk))
 
 	for i := 1; i <= 100; i++ {
 		ts.Add(float64(i))
+		clk.Advance(time.Millisecond * 100)
 	}
 	times, values := ts.LastN(-1)
 	require.Equal(t, []time.Time{
@@ -398,22 +377,18 @@ func TestTimeSeriesGauge(t *testing.T) {
 }
 
 func TestTimeSeriesGaugeWithSlidingWindow(t *testing.T) {
+	clk := NewFakeClock(time.Date(2025, 07, 21, 17, 31, 12, 0, time.FixedZone("Asia/Seoul", 9*60*60)))
 	ts := NewTimeSeries(time.Second, 10,
 		NewGauge().WithDerivers(
 			NewMovingAverage("ma3", 3),
 			NewMovingAverage("ma5", 5),
 		),
+		WithTimeSeriesClock(clk),
 	)
 
-	now := time.Date(2025, 07, 21, 17, 31, 12, 0, time.FixedZone("Asia/Seoul", 9*60*60))
-	nowFunc = func() time.Time {
-		ret := now
-		now = now.Add(time.Millisecond * 100)
-		return ret
-	}
-
 	for i := 1; i <= 100; i++ {
 		ts.Add(float64(i))
+		clk.Advance(time.Millisecond * 100)
 	}
 	times, values := ts.LastN(-1)
 	require.Equal(t, []time.Time{
@@ -471,17 +446,12 @@ func TestTimeSeriesGaugeWithSlidingWindow(t *testing.T) {
 }
 
 func TestTimeSeriesMeter(t *testing.T) {
-	ts := NewTimeSeries(time.Second, 10, NewMeter())
-
-	now := time.Date(2025, 07, 21, 17, 31, 12, 0, time.FixedZone("Asia/Seoul", 9*60*60))
-	nowFunc = func() time.Time {
-		ret := now
-		now = now.Add(time.Millisecond * 100)
-		return ret
-	}
+	clk := NewFakeClock(time.Date(2025, 07, 21, 17, 31, 12, 0, time.FixedZone("Asia/Seoul", 9*60*60)))
+	ts := NewTimeSeries(time.Second, 10, NewMeter(), WithTimeSeriesClock(clk))
 
 	for i := 1; i <= 100; i++ {
 		ts.Add(float64(i))
+		clk.Advance(time.Millisecond * 100)
 	}
 
 	times, values := ts.All()
@@ -512,22 +482,18 @@ func TestTimeSeriesMeter(t *testing.T) {
 }
 
 func TestTimeSeriesMeterWithSlidingWindow(t *testing.T) {
+	clk := NewFakeClock(time.Date(2025, 07, 21, 17, 31, 12, 0, time.FixedZone("Asia/Seoul", 9*60*60)))
 	ts := NewTimeSeries(time.Second, 10,
 		NewMeter().WithDerivers(
 			NewMovingAverage("ma3", 3),
 			NewMovingAverage("ma5", 5),
 		),
+		WithTimeSeriesClock(clk),
 	)
 
-	now := time.Date(2025, 07, 21, 17, 31, 12, 0, time.FixedZone("Asia/Seoul", 9*60*60))
-	nowFunc = func() time.Time {
-		ret := now
-		now = now.Add(time.Millisecond * 100)
-		return ret
-	}
-
 	for i := 1; i <= 100; i++ {
 		ts.Add(float64(i))
+		clk.Advance(time.Millisecond * 100)
 	}
 
 	times, values := ts.All()
@@ -586,17 +552,12 @@ func TestTimeSeriesMeterWithSlidingWindow(t *testing.T) {
 }
 
 func TestTimeSeriesTimer(t *testing.T) {
-	ts := NewTimeSeries(time.Second, 10, NewTimer())
-
-	now := time.Date(2025, 07, 21, 17, 31, 12, 0, time.FixedZone("Asia/Seoul", 9*60*60))
-	nowFunc = func() time.Time {
-		ret := now
-		now = now.Add(time.Millisecond * 100)
-		return ret
-	}
+	clk := NewFakeClock(time.Date(2025, 07, 21, 17, 31, 12, 0, time.FixedZone("Asia/Seoul", 9*60*60)))
+	ts := NewTimeSeries(time.Second, 10, NewTimer(), WithTimeSeriesClock(clk))
 
 	for i := 1; i <= 100; i++ {
 		ts.Add(float64(time.Duration(i) * time.Second))
+		clk.Advance(time.Millisecond * 100)
 	}
 
 	times, values := ts.All()
@@ -627,20 +588,15 @@ func TestTimeSeriesTimer(t *testing.T) {
 }
 
 func TestTimeSeriesTimerWithSlidingWindow(t *testing.T) {
+	clk := NewFakeClock(time.Date(2025, 07, 21, 17, 31, 12, 0, time.FixedZone("Asia/Seoul", 9*60*60)))
 	ts := NewTimeSeries(time.Second, 10, NewTimer().WithDerivers(
 		NewMovingAverage("ma3", 3),
 		NewMovingAverage("ma5", 5),
-	))
-
-	now := time.Date(2025, 07, 21, 17, 31, 12, 0, time.FixedZone("Asia/Seoul", 9*60*60))
-	nowFunc = func() time.Time {
-		ret := now
-		now = now.Add(time.Millisecond * 100)
-		return ret
-	}
+	), WithTimeSeriesClock(clk))
 
 	for i := 1; i <= 100; i++ {
 		ts.Add(float64(time.Duration(i) * time.Second))
+		clk.Advance(time.Millisecond * 100)
 	}
 
 	times, values := ts.All()
@@ -699,17 +655,12 @@ func TestTimeSeriesTimerWithSlidingWindow(t *testing.T) {
 }
 
 func TestTimeSeriesHistogram(t *testing.T) {
-	ts := NewTimeSeries(time.Second, 10, NewHistogram(100, 0.5, 0.75, 0.99))
-
-	now := time.Date(2025, 07, 21, 17, 31, 12, 0, time.FixedZone("Asia/Seoul", 9*60*60))
-	nowFunc = func() time.Time {
-		ret := now
-		now = now.Add(time.Millisecond * 100)
-		return ret
-	}
+	clk := NewFakeClock(time.Date(2025, 07, 21, 17, 31, 12, 0, time.FixedZone("Asia/Seoul", 9*60*60)))
+	ts := NewTimeSeries(time.Second, 10, NewHistogram(100, 0.5, 0.75, 0.99), WithTimeSeriesClock(clk))
 
 	for i := 1; i <= 100; i++ {
 		ts.Add(float64(i))
+		clk.Advance(time.Millisecond * 100)
 	}
 
 	times, values := ts.LastN(0)
@@ -740,20 +691,15 @@ func TestTimeSeriesHistogram(t *testing.T) {
 }
 
 func TestTimeSeriesHistogramWithSlidingWindow(t *testing.T) {
+	clk := NewFakeClock(time.Date(2025, 07, 21, 17, 31, 12, 0, time.FixedZone("Asia/Seoul", 9*60*60)))
 	ts := NewTimeSeries(time.Second, 10, NewHistogram(100, 0.5, 0.75, 0.99).WithDerivers(
 		NewMovingAverage("ma3", 3),
 		NewMovingAverage("ma5", 5),
-	))
-
-	now := time.Date(2025, 07, 21, 17, 31, 12, 0, time.FixedZone("Asia/Seoul", 9*60*60))
-	nowFunc = func() time.Time {
-		ret := now
-		now = now.Add(time.Millisecond * 100)
-		return ret
-	}
+	), WithTimeSeriesClock(clk))
 
 	for i := 1; i <= 100; i++ {
 		ts.Add(float64(i))
+		clk.Advance(time.Millisecond * 100)
 	}
 
 	times, values := ts.LastN(0)
@@ -810,3 +756,180 @@ func TestTimeSeriesHistogramWithSlidingWindow(t *testing.T) {
 		"ma5": &HistogramValue{Samples: 50, P: []float64{0.5, 0.75, 0.99}, Values: []float64{75, 78, 80}},
 	}}, values[9])
 }
+
+func TestTimeSeriesLateSample(t *testing.T) {
+	ts := NewTimeSeries(time.Second, 10, NewCounter())
+	base := time.Date(2023, 10, 1, 12, 4, 5, 0, time.UTC)
+
+	ts.AddTime(base.Add(100*time.Millisecond), 1)
+	ts.AddTime(base.Add(1100*time.Millisecond), 2)
+	// a late sample of the previous bin is added to the current bin
+	// and does not move the time of the series backwards
+	ts.AddTime(base.Add(900*time.Millisecond), 3)
+	ts.AddTime(base.Add(2100*time.Millisecond), math.NaN())
+
+	times, values := ts.LastN(3)
+	require.Equal(t, []time.Time{
+		time.Date(2023, 10, 1, 12, 4, 6, 0, time.UTC),
+		time.Date(2023, 10, 1, 12, 4, 7, 0, time.UTC),
+		time.Date(2023, 10, 1, 12, 4, 8, 0, time.UTC),
+	}, times)
+	require.Equal(t, []Value{
+		&CounterValue{Samples: 1, Value: 1},
+		&CounterValue{Samples: 2, Value: 5},
+		&CounterValue{Samples: 0, Value: 0},
+	}, values)
+}
+
+func TestTimeSeriesRate(t *testing.T) {
+	clk := NewFakeClock(time.Date(2025, 07, 21, 17, 31, 12, 0, time.UTC))
+	var products []Product
+	ts := NewTimeSeries(2*time.Second, 10, NewCounter(),
+		WithTimeSeriesClock(clk),
+		WithTimeSeriesDerivers(NewRate("rate", 1), NewRate("rate3", 3)),
+		WithListener(func(p Product) { products = append(products, p) }),
+	)
+	for range 70 {
+		ts.Add(1)
+		clk.Advance(100 * time.Millisecond)
+	}
+	// the listener receives the derived values
+	require.Len(t, products, 3)
+	require.Equal(t, &RateValue{Samples: 20, Value: 10}, products[0].Value.(*CounterValue).DerivedValues["rate"])
+	require.Equal(t, &RateValue{Samples: 60, Value: 10}, products[2].Value.(*CounterValue).DerivedValues["rate3"])
+
+	// derived values survive the JSON round trip
+	b, err := json.Marshal(ts)
+	require.NoError(t, err)
+	ts2 := NewTimeSeries(2*time.Second, 10, NewCounter(), WithTimeSeriesClock(clk))
+	require.NoError(t, json.Unmarshal(b, ts2))
+	_, values := ts2.All()
+	require.Equal(t, &RateValue{Samples: 20, Value: 10}, values[len(values)-2].(*CounterValue).DerivedValues["rate"])
+
+	// odometer handles the resets
+	ts = NewTimeSeries(time.Second, 10, NewOdometer().WithDerivers(NewRate("rate", 1)), WithTimeSeriesClock(clk))
+	for _, v := range []float64{100, 150, 200, 20, 70} {
+		ts.Add(v)
+		clk.Advance(500 * time.Millisecond)
+	}
+	_, values = ts.LastN(3)
+	require.Equal(t, &RateValue{Samples: 2, Value: 50}, values[0].(*OdometerValue).DerivedValues["rate"])
+	// 150 to 200, and from 0 to 20 after the reset
+	require.Equal(t, &RateValue{Samples: 2, Value: 70}, values[1].(*OdometerValue).DerivedValues["rate"])
+}
+
+func TestTimeSeriesEWMA(t *testing.T) {
+	clk := NewFakeClock(time.Date(2025, 07, 21, 17, 31, 12, 0, time.UTC))
+	ts := NewTimeSeries(time.Second, 10, NewGauge().WithDerivers(NewEWMA("ewma", 0.5)), WithTimeSeriesClock(clk))
+	for _, v := range []float64{10, 20, 30} {
+		ts.Add(v)
+		clk.Advance(time.Second)
+	}
+	ts.Add(40)
+	_, values := ts.LastN(4)
+	var avgs []float64
+	for _, v := range values {
+		avg, ok := FieldValue(v, "ewma.avg")
+		require.True(t, ok)
+		avgs = append(avgs, avg)
+	}
+	// the last one is preliminary
+	require.Equal(t, []float64{10, 15, 22.5, 31.25}, avgs)
+
+	// the bins without samples keep the average
+	clk.Advance(time.Second)
+	ts.Add(math.NaN())
+	clk.Advance(time.Second)
+	ts.Add(math.NaN())
+	_, values = ts.LastN(3)
+	require.Equal(t, int64(0), values[1].(*GaugeValue).Samples)
+	avg, ok := FieldValue(values[1], "ewma.avg")
+	require.True(t, ok)
+	require.Equal(t, 31.25, avg)
+
+	// restarts after a null bin
+	clk.Advance(3 * time.Second)
+	ts.Add(100)
+	_, values = ts.LastN(1)
+	require.Equal(t, &GaugeValue{Samples: 1, Sum: 100, Value: 100}, values[0].(*GaugeValue).DerivedValues["ewma"])
+}
+
+func TestEWMA(t *testing.T) {
+	require.InDelta(t, 1-math.Exp(-5.0/60), NewEWMATimeConstant("load1", time.Minute).(*EWMA).Alpha(5*time.Second), 1e-12)
+	require.InDelta(t, 0.5, NewEWMAHalfLife("h", 10*time.Second).(*EWMA).Alpha(10*time.Second), 1e-9)
+	require.Equal(t, 1.0, NewEWMA("x", 0).(*EWMA).Alpha(time.Second))
+
+	e := NewEWMA("ewma", 0.5)
+	require.Equal(t, &CounterValue{Samples: 0, Value: 2.5}, e.Derive([]Value{
+		&CounterValue{Samples: 1, Value: 10},
+		&CounterValue{Samples: 1, Value: 0},
+		&CounterValue{Samples: 0, Value: 0},
+	}))
+	// the increase of odometers is averaged across the resets
+	ov := e.Derive([]Value{
+		&OdometerValue{Samples: 2, First: 0, Last: 10},
+		&OdometerValue{Samples: 2, First: 10, Last: 2, Reset: 10},
+	}).(*OdometerValue)
+	require.Equal(t, 6.0, ov.Increase())
+	// the other values as they are
+	bv := &BucketHistogramValue{Samples: 1}
+	require.Same(t, bv, e.Derive([]Value{bv}))
+}
+
+func TestBand(t *testing.T) {
+	band := NewBand("band", 4, 2)
+	require.Equal(t, 5, band.WindowSize())
+	gauge := func(v float64) Value { return &GaugeValue{Samples: 1, Sum: v, Value: v} }
+	bv := band.Derive([]Value{gauge(2), nil, gauge(4), &GaugeValue{}, gauge(20)}).(*BandValue)
+	require.Equal(t, &BandValue{Bins: 2, Mean: 3, StdDev: 1, Upper: 5, Lower: 1, ZScore: 17}, bv)
+
+	// timers in nanoseconds
+	timer := func(d time.Duration) Value { return &TimerValue{Samples: 2, Sum: 2 * d, Min: d, Max: d} }
+	bv = band.Derive([]Value{timer(time.Second), timer(time.Second), timer(time.Second)}).(*BandValue)
+	require.Equal(t, float64(time.Second), bv.Mean)
+	require.Equal(t, 0.0, bv.ZScore)
+
+	// a field of the values
+	meter := func(max float64) Value { return &MeterValue{Samples: 1, Max: max} }
+	bv = NewBandField("band", "max", 4, 1).Derive([]Value{meter(1), meter(3), meter(5)}).(*BandValue)
+	require.Equal(t, 2.0, bv.Mean)
+	require.Equal(t, 3.0, bv.ZScore)
+
+	bv = band.Derive([]Value{nil, &CounterValue{Samples: 1, Value: 1}}).(*BandValue)
+	_, ok := FieldValue(bv, "zscore")
+	require.False(t, ok, "no history")
+
+	clk := NewFakeClock(time.Date(2025, 07, 21, 17, 31, 12, 0, time.UTC))
+	ts := NewTimeSeries(time.Second, 10, NewCounter().WithDerivers(NewBand("band", 3, 2)), WithTimeSeriesClock(clk))
+	for _, v := range []float64{10, 12, 14, 40} {
+		ts.Add(v)
+		clk.Advance(time.Second)
+	}
+	_, values := ts.LastN(2)
+	z, ok := FieldValue(values[0], "band.zscore")
+	require.True(t, ok)
+	require.Equal(t, 3.0, z)
+	// the preliminary one of the current bin
+	z, ok = FieldValue(values[1], "band.zscore")
+	require.True(t, ok)
+	require.InDelta(t, 28/math.Sqrt(8.0/3), z, 1e-9)
+}
+
+func TestTimeSeriesUnmarshalZero(t *testing.T) {
+	clk := NewFakeClock(time.Date(2025, 07, 21, 17, 31, 12, 0, time.UTC))
+	ts := NewTimeSeries(time.Second, 10, NewGauge(), WithTimeSeriesClock(clk))
+	for i := range 3 {
+		ts.Add(float64(i))
+		clk.Advance(time.Second)
+	}
+	b, err := json.Marshal(ts)
+	require.NoError(t, err)
+
+	var ts2 TimeSeries
+	require.NoError(t, json.Unmarshal(b, &ts2))
+	times, values := ts2.All()
+	n := len(values)
+	require.True(t, times[n-1].Equal(time.Date(2025, 07, 21, 17, 31, 15, 0, time.UTC)), "%v", times)
+	require.Equal(t, 1.0, values[n-2].(*GaugeValue).Value)
+	require.Equal(t, 2.0, values[n-1].(*GaugeValue).Value)
+}
@@ -0,0 +1,198 @@
+package metric
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"sync"
+)
+
+// the precision of Unique, 2^12 registers of the standard error 1.04/sqrt(4096), about 1.6%
+const (
+	uniquePrecision = 12
+	uniqueRegisters = 1 << uniquePrecision
+)
+
+// HashKey returns the 64-bit hash of the key that Unique counts, see Gather.AddKey.
+func HashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return mix64(h.Sum64())
+}
+
+// mix64 is the finalizer of MurmurHash3, which spreads the bits of FNV over all the registers.
+func mix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// HashAdder is a Producer that takes the hashes of the keys, such as Unique.
+type HashAdder interface {
+	AddHash(uint64)
+}
+
+func NewUnique() *Unique {
+	return &Unique{}
+}
+
+var _ Producer = (*Unique)(nil)
+var _ Merger = (*Unique)(nil)
+var _ HashAdder = (*Unique)(nil)
+
+// Unique estimates the number of the distinct keys by HyperLogLog.
+// The registers of the bins are merged by their maximums,
+// so that the rollups count the keys seen in any of the bins only once.
+type Unique struct {
+	sync.Mutex
+	samples   int64
+	registers []byte // allocated by the first sample
+	derivers  []Deriver
+}
+
+func (u *Unique) WithDerivers(derivers ...Deriver) *Unique {
+	u.derivers = append(u.derivers, derivers...)
+	return u
+}
+
+func (u *Unique) Derivers() []Deriver {
+	return u.derivers
+}
+
+// Add counts the value as a key, e.g. a numeric user ID.
+func (u *Unique) Add(v float64) {
+	if math.IsNaN(v) {
+		return
+	}
+	u.AddHash(mix64(math.Float64bits(v)))
+}
+
+// AddKey counts the key.
+func (u *Unique) AddKey(key string) {
+	u.AddHash(HashKey(key))
+}
+
+// AddHash counts the key of the hash, which should be uniformly distributed as HashKey.
+func (u *Unique) AddHash(h uint64) {
+	u.Lock()
+	defer u.Unlock()
+	if u.registers == nil {
+		u.registers = make([]byte, uniqueRegisters)
+	}
+	idx := h >> (64 - uniquePrecision)
+	// the position of the first 1-bit of the rest, which is capped by the guard bit
+	rank := byte(bits.LeadingZeros64(h<<uniquePrecision|1<<(uniquePrecision-1)) + 1)
+	if rank > u.registers[idx] {
+		u.registers[idx] = rank
+	}
+	u.samples++
+}
+
+// Merge takes the maximums of the registers of a UniqueValue.
+func (u *Unique) Merge(v Value) error {
+	uv, ok := v.(*UniqueValue)
+	if !ok {
+		return fmt.Errorf("%w: %T into unique", ErrNotMergeable, v)
+	}
+	if uv.Samples == 0 {
+		return nil
+	}
+	if len(uv.Registers) != uniqueRegisters {
+		return fmt.Errorf("%w: unique of %d registers", ErrNotMergeable, len(uv.Registers))
+	}
+	u.Lock()
+	defer u.Unlock()
+	if u.registers == nil {
+		u.registers = make([]byte, uniqueRegisters)
+	}
+	for i, r := range uv.Registers {
+		u.registers[i] = max(u.registers[i], r)
+	}
+	u.samples += uv.Samples
+	return nil
+}
+
+func (u *Unique) Produce(reset bool) Value {
+	u.Lock()
+	defer u.Unlock()
+	ret := &UniqueValue{
+		Samples: u.samples,
+	}
+	if u.registers != nil {
+		ret.Registers = make([]byte, len(u.registers))
+		copy(ret.Registers, u.registers)
+		ret.Value = estimateUnique(u.registers)
+	}
+	if reset {
+		u.samples = 0
+		u.registers = nil
+	}
+	return ret
+}
+
+func (u *Unique) String() string {
+	return u.Produce(false).String()
+}
+
+func (u *Unique) MarshalJSON() ([]byte, error) {
+	return json.Marshal(u.Produce(false))
+}
+
+func (u *Unique) UnmarshalJSON(data []byte) error {
+	p := &UniqueValue{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return err
+	}
+	if p.Registers != nil && len(p.Registers) != uniqueRegisters {
+		return fmt.Errorf("unique: %d registers", len(p.Registers))
+	}
+	u.samples = p.Samples
+	u.registers = p.Registers
+	return nil
+}
+
+// estimateUnique returns the HyperLogLog estimate of the registers,
+// with the linear counting of the empty registers for the small cardinalities.
+func estimateUnique(registers []byte) float64 {
+	m := float64(len(registers))
+	var sum float64
+	var zeros int
+	for _, r := range registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	est := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if est <= 2.5*m && zeros > 0 {
+		est = m * math.Log(m/float64(zeros))
+	}
+	return math.Round(est)
+}
+
+// UniqueValue is the value of Unique, Value is the estimated number of the distinct keys
+// and Samples is the number of the keys added including the duplicates.
+type UniqueValue struct {
+	Samples   int64   `json:"samples"`
+	Value     float64 `json:"value"`
+	Registers []byte  `json:"registers,omitempty"`
+	// Optional derived values, such as moving averages
+	DerivedValues DerivedValues `json:"derived,omitempty"`
+}
+
+func (uv *UniqueValue) String() string {
+	b, _ := json.Marshal(uv)
+	return string(b)
+}
+
+func (uv *UniqueValue) SetDerivedValue(name string, value Value) {
+	if uv.DerivedValues == nil {
+		uv.DerivedValues = make(DerivedValues)
+	}
+	uv.DerivedValues[name] = value
+}
@@ -0,0 +1,125 @@
+package metric
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnique(t *testing.T) {
+	u := NewUnique()
+	require.Equal(t, &UniqueValue{}, u.Produce(false))
+
+	for _, n := range []int{1, 10, 100, 1000, 10000, 100000} {
+		for i := range n {
+			u.AddKey(fmt.Sprintf("user-%d", i))
+			// duplicates do not count
+			u.AddKey(fmt.Sprintf("user-%d", i))
+		}
+		uv := u.Produce(true).(*UniqueValue)
+		require.Equal(t, int64(2*n), uv.Samples)
+		require.InEpsilon(t, float64(n), uv.Value, 0.05, "n=%d", n)
+	}
+
+	for i := range 1000 {
+		u.Add(float64(i))
+	}
+	require.InEpsilon(t, 1000, u.Produce(false).(*UniqueValue).Value, 0.05)
+}
+
+func TestUniqueMerge(t *testing.T) {
+	a, b := NewUnique(), NewUnique()
+	for i := range 6000 {
+		a.AddKey(fmt.Sprintf("user-%d", i))
+	}
+	for i := 4000; i < 10000; i++ {
+		b.AddKey(fmt.Sprintf("user-%d", i))
+	}
+	require.NoError(t, a.Merge(b.Produce(false)))
+	require.NoError(t, a.Merge(&UniqueValue{}))
+	uv := a.Produce(false).(*UniqueValue)
+	require.Equal(t, int64(12000), uv.Samples)
+	require.InEpsilon(t, 10000, uv.Value, 0.05)
+
+	require.ErrorIs(t, a.Merge(&CounterValue{}), ErrNotMergeable)
+	require.ErrorIs(t, a.Merge(&UniqueValue{Samples: 1, Registers: []byte{1}}), ErrNotMergeable)
+
+	v, ok := FieldValue(uv, "value")
+	require.True(t, ok)
+	require.Equal(t, uv.Value, v)
+
+	// the moving average counts the keys over the window once
+	ma := NewMovingAverage("ma", 2).Derive([]Value{b.Produce(false), nil, uv}).(*UniqueValue)
+	require.Equal(t, uv.Value, ma.Value)
+}
+
+func TestUniqueJSON(t *testing.T) {
+	u := NewUnique()
+	for i := range 500 {
+		u.AddKey(fmt.Sprintf("user-%d", i))
+	}
+	b, err := json.Marshal(u)
+	require.NoError(t, err)
+	u2 := NewUnique()
+	require.NoError(t, json.Unmarshal(b, u2))
+	require.Equal(t, u.Produce(false), u2.Produce(false))
+
+	var pd Product
+	require.NoError(t, parseProduct(&pd, `{"name":"users","type":"unique","value":`+u.String()+`}`, true))
+	require.Equal(t, u.Produce(false), pd.Value)
+
+	require.Error(t, json.Unmarshal([]byte(`{"samples":1,"registers":"AQ=="}`), u2))
+}
+
+func TestCollectorUnique(t *testing.T) {
+	fine, err := NewSeriesID("FINE", "1m/1s", time.Second, 60)
+	require.NoError(t, err)
+	coarse, err := NewSeriesID("COARSE", "10m/10s", 10*time.Second, 60)
+	require.NoError(t, err)
+
+	c := NewCollector(WithRollupChain(fine, coarse))
+	var mu sync.Mutex
+	products := map[string][]Product{}
+	c.AddOutputFunc(func(p Product) error {
+		mu.Lock()
+		products[p.SeriesID] = append(products[p.SeriesID], p)
+		mu.Unlock()
+		return nil
+	})
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	typ := UniqueType(UnitShort)
+	for i := range 20 {
+		g := &Gather{ts: now.Add(time.Duration(i) * time.Second)}
+		// 100 users a second, half of them are seen in the previous second
+		for j := range 100 {
+			g.AddKey("users", fmt.Sprintf("user-%d", i*50+j), typ)
+		}
+		c.receive(g)
+	}
+	c.receive(&Gather{ts: now.Add(30 * time.Second), noop: true})
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, products["FINE"], 20)
+	require.Len(t, products["COARSE"], 2)
+	for _, p := range products["FINE"] {
+		require.InEpsilon(t, 100, p.Value.(*UniqueValue).Value, 0.05)
+	}
+	for _, p := range products["COARSE"] {
+		uv := p.Value.(*UniqueValue)
+		require.Equal(t, int64(1000), uv.Samples)
+		require.InEpsilon(t, 550, uv.Value, 0.05)
+	}
+
+	ss := Snapshot{Times: []time.Time{now, now.Add(10 * time.Second)},
+		Values: []Value{products["COARSE"][0].Value, nil},
+		Meta:   SeriesInfo{MeasureName: "users", MeasureType: typ}}
+	series := ss.Series(Chart{})
+	require.Len(t, series, 1)
+	require.Equal(t, products["COARSE"][0].Value.(*UniqueValue).Value, series[0].Data[0].Value)
+	require.Nil(t, series[0].Data[1].Value)
+}
@@ -1,13 +1,15 @@
 package metric
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 	"time"
 )
 
-var nowFunc func() time.Time = time.Now
-
-var timeZone *time.Location = time.Local
+var ErrNotMergeable = errors.New("value is not mergeable")
+var ErrNotHashable = errors.New("producer does not take hashed keys")
 
 // T is the input type for the time series.
 // P is the type of the value stored in the time series.
@@ -39,6 +41,54 @@ type DerivingValue interface {
 	SetDerivedValue(name string, value Value)
 }
 
+// DerivedValues are the values derived by the Derivers, keyed by their IDs.
+// Each value is marshaled with its type, so that it can be unmarshaled back.
+type DerivedValues map[string]Value
+
+type derivedValueJSON struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+func (dv DerivedValues) MarshalJSON() ([]byte, error) {
+	obj := make(map[string]derivedValueJSON, len(dv))
+	for id, v := range dv {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		obj[id] = derivedValueJSON{Type: fmt.Sprintf("%T", v), Value: b}
+	}
+	return json.Marshal(obj)
+}
+
+func (dv *DerivedValues) UnmarshalJSON(data []byte) error {
+	var obj map[string]derivedValueJSON
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	ret := make(DerivedValues, len(obj))
+	for id, o := range obj {
+		v, err := newValue(o.Type)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(o.Value, v); err != nil {
+			return err
+		}
+		ret[id] = v
+	}
+	*dv = ret
+	return nil
+}
+
+// Merger is an optional interface of Producer.
+// Merge adds a Value produced by the same type of Producer,
+// so that a coarser time series can be built from the bins of a finer one.
+type Merger interface {
+	Merge(Value) error
+}
+
 type Marker interface {
 	Mark()
 }
@@ -48,6 +98,7 @@ type Type struct {
 	p func() Producer
 	s string
 	u Unit
+	d []Deriver
 }
 
 func (ft Type) Empty() bool {
@@ -66,6 +117,24 @@ func (ft Type) Unit() Unit {
 	return ft.u
 }
 
+// Derivers returns the derivers added by WithDerivers.
+func (ft Type) Derivers() []Deriver {
+	return ft.d
+}
+
+// WithDerivers returns a copy of the type with the derivers added,
+// which derive the values of the time series of the collector, e.g. NewRate.
+func (ft Type) WithDerivers(derivers ...Deriver) Type {
+	ft.d = slices.Concat(ft.d, derivers)
+	return ft
+}
+
+// WithUnit returns a copy of the type with the unit.
+func (ft Type) WithUnit(u Unit) Type {
+	ft.u = u
+	return ft
+}
+
 // CounterType supports only value: sum
 func CounterType(u Unit) Type {
 	return Type{
@@ -103,7 +172,7 @@ func TimerType() Type {
 	}
 }
 
-// OdometerType supports: first, last, diff, non_negative_diff, abs_diff
+// OdometerType supports: first, last, diff, non_negative_diff, abs_diff, increase
 func OdometerType(u Unit) Type {
 	return Type{
 		p: func() Producer { return NewOdometer() },
@@ -129,6 +198,38 @@ func HistogramTypePercentiles(u Unit, maxBin int, ps ...float64) Type {
 	}
 }
 
+// SketchHistogramType supports: p[1-999] percentiles e.g. p50, p90, p99
+// The percentiles are within the relative accuracy, e.g. 0.01 for 1%,
+// and stay so over the rollups and the moving averages, see SketchHistogram.
+func SketchHistogramType(u Unit, relativeAccuracy float64, ps ...float64) Type {
+	return Type{
+		p: func() Producer { return NewSketchHistogram(relativeAccuracy, ps...) },
+		s: "histogram",
+		u: u,
+	}
+}
+
+// BucketHistogramType supports: samples, sum, avg and the cumulative bucket counts,
+// e.g. le_0.5 and le_inf, of the upper bounds, default is DefaultBuckets.
+// Its values merge exactly, and Quantile() estimates the quantiles as Prometheus does.
+func BucketHistogramType(u Unit, bounds ...float64) Type {
+	return Type{
+		p: func() Producer { return NewBucketHistogram(bounds...) },
+		s: "bucket_histogram",
+		u: u,
+	}
+}
+
+// UniqueType supports: value of the estimated number of the distinct keys, and samples.
+// The keys are added by Gather.AddKey or KeyMeasure, see Unique.
+func UniqueType(u Unit) Type {
+	return Type{
+		p: func() Producer { return NewUnique() },
+		s: "unique",
+		u: u,
+	}
+}
+
 type Unit string
 
 const (
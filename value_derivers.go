@@ -1,6 +1,11 @@
 package metric
 
-import "time"
+import (
+	"encoding/json"
+	"math"
+	"slices"
+	"time"
+)
 
 type Deriver interface {
 	ID() string
@@ -8,6 +13,13 @@ type Deriver interface {
 	Derive(values []Value) Value
 }
 
+// IntervalDeriver is an optional interface of Deriver that needs the period of the bins.
+// TimeSeries calls DeriveInterval instead of Derive with its interval.
+type IntervalDeriver interface {
+	Deriver
+	DeriveInterval(values []Value, interval time.Duration) Value
+}
+
 func NewMovingAverage(id string, windowSize int) Deriver {
 	return &MovingAverage{id: id, windowSize: windowSize}
 }
@@ -42,6 +54,10 @@ func (ma MovingAverage) Derive(values []Value) Value {
 		return ma.DeriveTimer(values)
 	case *HistogramValue:
 		return ma.DeriveHistogram(values)
+	case *BucketHistogramValue:
+		return ma.DeriveBucketHistogram(values)
+	case *UniqueValue:
+		return ma.DeriveUnique(values)
 	default:
 		return values[len(values)-1]
 	}
@@ -177,7 +193,12 @@ func (ma MovingAverage) DeriveTimer(values []Value) Value {
 	return ret
 }
 
+// DeriveHistogram returns the percentiles of the merged sketches if the values have sketches,
+// otherwise the averages of the percentiles.
 func (ma MovingAverage) DeriveHistogram(values []Value) Value {
+	if ret, ok := ma.mergeSketches(values); ok {
+		return ret
+	}
 	var validValues []float64
 	var validP []float64
 	var validValueCount int
@@ -215,3 +236,387 @@ func (ma MovingAverage) DeriveHistogram(values []Value) Value {
 	}
 	return ret
 }
+
+// mergeSketches merges the sketches of the histogram values,
+// it returns false if a value with samples has no sketch.
+func (ma MovingAverage) mergeSketches(values []Value) (Value, bool) {
+	var merged *Sketch
+	var p []float64
+	for _, value := range values {
+		val, ok := value.(*HistogramValue)
+		if !ok || val.Samples == 0 {
+			continue
+		}
+		if val.Sketch == nil {
+			return nil, false
+		}
+		if merged == nil {
+			merged = NewSketch(val.Sketch.RelativeAccuracy)
+			p = val.P
+		}
+		if err := merged.Merge(val.Sketch); err != nil {
+			return nil, false
+		}
+	}
+	if merged == nil {
+		return nil, false
+	}
+	return &HistogramValue{
+		Samples: int64(merged.Count),
+		P:       p,
+		Values:  sketchQuantiles(merged, p),
+	}, true
+}
+
+// DeriveBucketHistogram returns the bucket counts merged over the window,
+// the values of the bounds different from the last value are skipped.
+func (ma MovingAverage) DeriveBucketHistogram(values []Value) Value {
+	last := values[len(values)-1].(*BucketHistogramValue)
+	h := &BucketHistogram{bounds: last.Bounds, counts: make([]int64, len(last.Bounds)+1)}
+	for _, value := range values {
+		if val, ok := value.(*BucketHistogramValue); ok {
+			h.Merge(val)
+		}
+	}
+	return h.Produce(false)
+}
+
+// DeriveUnique returns the estimated number of the distinct keys over the window,
+// a key seen in several bins is counted once.
+func (ma MovingAverage) DeriveUnique(values []Value) Value {
+	u := NewUnique()
+	for _, value := range values {
+		if val, ok := value.(*UniqueValue); ok {
+			u.Merge(val)
+		}
+	}
+	return u.Produce(false)
+}
+
+// NewRate returns a Deriver of the per-second rate of counters and odometers
+// over the last windowSize bins, at least one.
+func NewRate(id string, windowSize int) Deriver {
+	return &Rate{id: id, windowSize: max(windowSize, 1)}
+}
+
+var _ IntervalDeriver = Rate{}
+
+// Rate derives the per-second rate as a RateValue.
+// The rate of a counter is the sum of the values divided by the period of the bins,
+// the one of an odometer is its Increase(), which handles the counter resets.
+// The null bins are not counted in the period.
+type Rate struct {
+	id         string
+	windowSize int
+}
+
+func (r Rate) ID() string {
+	return r.id
+}
+
+func (r Rate) WindowSize() int {
+	return r.windowSize
+}
+
+// Derive returns the rate assuming the bins are one second.
+func (r Rate) Derive(values []Value) Value {
+	return r.DeriveInterval(values, time.Second)
+}
+
+func (r Rate) DeriveInterval(values []Value, interval time.Duration) Value {
+	var increase float64
+	var samples int64
+	var bins int
+	for _, value := range values {
+		switch val := value.(type) {
+		case *CounterValue:
+			increase += val.Value
+			samples += val.Samples
+		case *OdometerValue:
+			increase += val.Increase()
+			samples += val.Samples
+		default:
+			continue
+		}
+		bins++
+	}
+	ret := &RateValue{Samples: samples}
+	if bins > 0 && interval > 0 {
+		ret.Value = increase / (float64(bins) * interval.Seconds())
+	}
+	return ret
+}
+
+// RateValue is the value of Rate.
+type RateValue struct {
+	Samples int64   `json:"samples"`
+	Value   float64 `json:"value"` // per second
+}
+
+func (rv *RateValue) String() string {
+	b, _ := json.Marshal(rv)
+	return string(b)
+}
+
+// IncrementalDeriver is an optional interface of Deriver that derives a value
+// from the value derived on the previous bin and the current value,
+// so that TimeSeries does not look up the window for it.
+// prev is nil if the previous bin is null or has no derived value of the ID.
+type IncrementalDeriver interface {
+	Deriver
+	DeriveNext(prev Value, current Value, interval time.Duration) Value
+}
+
+// NewEWMA returns a Deriver of the exponentially weighted moving average
+// of the smoothing factor alpha in (0, 1], the weight of the current bin.
+// If alpha is out of the range, it is 1, which does not smooth at all.
+func NewEWMA(id string, alpha float64) Deriver {
+	if alpha <= 0 || alpha > 1 {
+		alpha = 1
+	}
+	return &EWMA{id: id, alpha: alpha}
+}
+
+// NewEWMAHalfLife returns an EWMA whose weight of a bin halves every halfLife,
+// so that it reacts in the same time whatever the period of the bins is.
+func NewEWMAHalfLife(id string, halfLife time.Duration) Deriver {
+	return &EWMA{id: id, tau: time.Duration(float64(halfLife) / math.Ln2)}
+}
+
+// NewEWMATimeConstant returns an EWMA of the time constant tau,
+// e.g. 1, 5 and 15 minutes for the load averages of Unix.
+func NewEWMATimeConstant(id string, tau time.Duration) Deriver {
+	return &EWMA{id: id, tau: tau}
+}
+
+var _ IncrementalDeriver = EWMA{}
+
+// EWMA derives the exponentially weighted moving average incrementally from
+// the average of the previous bin, it restarts from the current value after a null bin.
+// The derived value is of the same type of the current value, whose fields are averaged:
+// the avg, the last, the min, the max of gauges, meters and timers, the value of counters and rates,
+// the percentiles of histograms, and the first, the last and the resets of odometers,
+// so that the Increase() is the average of the increases.
+// The bins without samples keep the average of gauges, meters, timers and histograms,
+// while the ones of counters, rates and odometers decay the average as zero.
+// Other values are returned as they are.
+type EWMA struct {
+	id    string
+	alpha float64
+	tau   time.Duration // if set, alpha depends on the interval
+}
+
+func (e EWMA) ID() string {
+	return e.id
+}
+
+func (e EWMA) WindowSize() int {
+	return 0
+}
+
+// Alpha returns the smoothing factor of the bins of the interval.
+func (e EWMA) Alpha(interval time.Duration) float64 {
+	if e.tau <= 0 {
+		return e.alpha
+	}
+	return 1 - math.Exp(-float64(interval)/float64(e.tau))
+}
+
+// Derive folds the values from the oldest one assuming the bins are one second.
+func (e EWMA) Derive(values []Value) Value {
+	var ret Value
+	for _, value := range values {
+		if value == nil {
+			ret = nil
+			continue
+		}
+		ret = e.DeriveNext(ret, value, time.Second)
+	}
+	return ret
+}
+
+func (e EWMA) DeriveNext(prev Value, current Value, interval time.Duration) Value {
+	a := e.Alpha(interval)
+	ewma := func(p, x float64) float64 { return p + a*(x-p) }
+	switch cur := current.(type) {
+	case *CounterValue:
+		ret := &CounterValue{Samples: cur.Samples, Value: cur.Value}
+		if p, ok := prev.(*CounterValue); ok {
+			ret.Value = ewma(p.Value, cur.Value)
+		}
+		return ret
+	case *RateValue:
+		ret := &RateValue{Samples: cur.Samples, Value: cur.Value}
+		if p, ok := prev.(*RateValue); ok {
+			ret.Value = ewma(p.Value, cur.Value)
+		}
+		return ret
+	case *OdometerValue:
+		ret := &OdometerValue{Samples: cur.Samples, First: cur.First, Last: cur.Last, Reset: cur.Reset}
+		if p, ok := prev.(*OdometerValue); ok {
+			ret.First = ewma(p.First, cur.First)
+			ret.Last = ewma(p.Last, cur.Last)
+			ret.Reset = ewma(p.Reset, cur.Reset)
+		}
+		return ret
+	case *GaugeValue:
+		p, ok := prev.(*GaugeValue)
+		if cur.Samples == 0 {
+			if ok {
+				return p
+			}
+			return &GaugeValue{}
+		}
+		ret := &GaugeValue{Samples: cur.Samples, Sum: cur.Sum, Value: cur.Value}
+		if ok && p.Samples > 0 {
+			ret.Sum = ewma(p.Sum/float64(p.Samples), cur.Sum/float64(cur.Samples)) * float64(cur.Samples)
+			ret.Value = ewma(p.Value, cur.Value)
+		}
+		return ret
+	case *MeterValue:
+		p, ok := prev.(*MeterValue)
+		if cur.Samples == 0 {
+			if ok {
+				return p
+			}
+			return &MeterValue{}
+		}
+		ret := &MeterValue{Samples: cur.Samples, Sum: cur.Sum, First: cur.First, Last: cur.Last, Min: cur.Min, Max: cur.Max}
+		if ok && p.Samples > 0 {
+			ret.Sum = ewma(p.Sum/float64(p.Samples), cur.Sum/float64(cur.Samples)) * float64(cur.Samples)
+			ret.First = ewma(p.First, cur.First)
+			ret.Last = ewma(p.Last, cur.Last)
+			ret.Min = ewma(p.Min, cur.Min)
+			ret.Max = ewma(p.Max, cur.Max)
+		}
+		return ret
+	case *TimerValue:
+		p, ok := prev.(*TimerValue)
+		if cur.Samples == 0 {
+			if ok {
+				return p
+			}
+			return &TimerValue{}
+		}
+		ret := &TimerValue{Samples: cur.Samples, Sum: cur.Sum, Min: cur.Min, Max: cur.Max}
+		if ok && p.Samples > 0 {
+			avg := ewma(float64(p.Sum)/float64(p.Samples), float64(cur.Sum)/float64(cur.Samples))
+			ret.Sum = time.Duration(avg * float64(cur.Samples))
+			ret.Min = time.Duration(ewma(float64(p.Min), float64(cur.Min)))
+			ret.Max = time.Duration(ewma(float64(p.Max), float64(cur.Max)))
+		}
+		return ret
+	case *HistogramValue:
+		p, ok := prev.(*HistogramValue)
+		if cur.Samples == 0 {
+			if ok {
+				return p
+			}
+			return &HistogramValue{P: cur.P, Values: make([]float64, len(cur.P))}
+		}
+		ret := &HistogramValue{Samples: cur.Samples, P: cur.P, Values: slices.Clone(cur.Values)}
+		if ok && p.Samples > 0 && slices.Equal(p.P, cur.P) && len(p.Values) == len(cur.Values) {
+			for i := range ret.Values {
+				ret.Values[i] = ewma(p.Values[i], cur.Values[i])
+			}
+		}
+		return ret
+	default:
+		return current
+	}
+}
+
+// NewBand returns a Deriver of the Bollinger bands of the mean plus and minus k standard deviations
+// over the windowSize bins before the current one, of the primary field of the values, see FieldValue.
+func NewBand(id string, windowSize int, k float64) Deriver {
+	return NewBandField(id, "", windowSize, k)
+}
+
+// NewBandField returns a band Deriver of the field of the values, see FieldValue.
+// An empty field is the default one of NewBand.
+func NewBandField(id string, field string, windowSize int, k float64) Deriver {
+	return &Band{id: id, field: field, windowSize: max(windowSize, 2), k: k}
+}
+
+var _ Deriver = Band{}
+
+// Band derives the rolling mean and standard deviation of the history bins,
+// the bins before the current one, and the z-score of the current bin relative to them.
+// The null bins and the bins without samples are skipped.
+type Band struct {
+	id         string
+	field      string
+	windowSize int // number of the history bins
+	k          float64
+}
+
+func (b Band) ID() string {
+	return b.id
+}
+
+// WindowSize is the number of the history bins and the current one.
+func (b Band) WindowSize() int {
+	return b.windowSize + 1
+}
+
+func (b Band) Derive(values []Value) Value {
+	ret := &BandValue{}
+	if len(values) == 0 {
+		return ret
+	}
+	var sum, sumSq float64
+	for _, value := range values[:len(values)-1] {
+		x, ok := primaryFieldValue(value, b.field)
+		if !ok {
+			continue
+		}
+		ret.Bins++
+		sum += x
+		sumSq += x * x
+	}
+	if ret.Bins == 0 {
+		return ret
+	}
+	n := float64(ret.Bins)
+	ret.Mean = sum / n
+	ret.StdDev = math.Sqrt(max(sumSq/n-ret.Mean*ret.Mean, 0))
+	ret.Upper = ret.Mean + b.k*ret.StdDev
+	ret.Lower = ret.Mean - b.k*ret.StdDev
+	if x, ok := primaryFieldValue(values[len(values)-1], b.field); ok && ret.StdDev > 0 {
+		ret.ZScore = (x - ret.Mean) / ret.StdDev
+	}
+	return ret
+}
+
+// primaryFieldValue returns the field of the value, or the primary field if the field is empty,
+// see FieldValue.
+func primaryFieldValue(v Value, field string) (float64, bool) {
+	if field == "" {
+		switch v.(type) {
+		case *CounterValue, *UniqueValue:
+			field = "value"
+		case *GaugeValue, *MeterValue, *TimerValue:
+			field = "avg"
+		case *OdometerValue:
+			field = "last"
+		default:
+			return 0, false
+		}
+	}
+	return FieldValue(v, field)
+}
+
+// BandValue is the value of Band, the standard deviation is of the population of the history bins.
+type BandValue struct {
+	Bins   int     `json:"bins"` // number of the history bins with samples
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stddev"`
+	Upper  float64 `json:"upper"`
+	Lower  float64 `json:"lower"`
+	ZScore float64 `json:"zscore"` // zero if the standard deviation is zero
+}
+
+func (bv *BandValue) String() string {
+	b, _ := json.Marshal(bv)
+	return string(b)
+}